@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// appIconContents is the Contents.json file of an Xcode asset catalog icon.
+type appIconContents struct {
+	Images []appIconImage `json:"images"`
+	Info   struct {
+		Author  string `json:"author"`
+		Version int    `json:"version"`
+	} `json:"info"`
+}
+
+type appIconImage struct {
+	Filename string `json:"filename,omitempty"`
+	Idiom    string `json:"idiom"`
+	Scale    string `json:"scale"`
+	Size     string `json:"size"`
+}
+
+// WriteAppIconset writes the images of the icon to an Xcode .appiconset directory,
+// created if needed, along with its Contents.json file.
+func (i *ICNS) WriteAppIconset(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var contents appIconContents
+	contents.Info.Author = "xcode"
+	contents.Info.Version = 1
+
+	for _, file := range iconsetFiles {
+		f := supportedImageFormats[file.code]
+		entry := appIconImage{
+			Idiom: "mac",
+			Scale: fmt.Sprintf("%dx", f.Scale),
+			Size:  fmt.Sprintf("%dx%d", f.PointSize, f.PointSize),
+		}
+
+		if a := i.iconsetImage(f); a != nil {
+			data, err := pngData(a)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.name, err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, file.name), data, 0o644); err != nil {
+				return err
+			}
+			entry.Filename = file.name
+		}
+		contents.Images = append(contents.Images, entry)
+	}
+
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "Contents.json"), append(data, '\n'), 0o644)
+}
+
+// FromAppIconset creates an icon from the mac images of an Xcode .appiconset directory,
+// as listed by its Contents.json file. The formats used by iconutil are preferred
+// for each point size and scale.
+func FromAppIconset(fsys fs.FS) (*ICNS, error) {
+	data, err := fs.ReadFile(fsys, "Contents.json")
+	if err != nil {
+		return nil, err
+	}
+	var contents appIconContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("Contents.json: %w", err)
+	}
+
+	i := &ICNS{
+		minCompat: Newest,
+		maxCompat: Oldest,
+	}
+	for _, entry := range contents.Images {
+		if entry.Idiom != "mac" || entry.Filename == "" {
+			continue
+		}
+
+		var pt, pt2, scale uint
+		if _, err := fmt.Sscanf(entry.Size, "%dx%d", &pt, &pt2); err != nil || pt != pt2 {
+			return nil, fmt.Errorf("%s: invalid size %q", entry.Filename, entry.Size)
+		}
+		if _, err := fmt.Sscanf(entry.Scale, "%dx", &scale); err != nil {
+			return nil, fmt.Errorf("%s: invalid scale %q", entry.Filename, entry.Scale)
+		}
+
+		f := appIconFormat(pt, scale)
+		if f == nil {
+			return nil, fmt.Errorf("%s: no format for %s@%s", entry.Filename, entry.Size, entry.Scale)
+		}
+		if a, _ := i.ByCode(f.Code); a != nil {
+			return nil, fmt.Errorf("%s: several images for %s@%s", entry.Filename, entry.Size, entry.Scale)
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.addPNG(f, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Filename, err)
+		}
+	}
+
+	if len(i.Assets) == 0 {
+		return nil, fmt.Errorf("no mac image found")
+	}
+	return i, nil
+}
+
+// appIconFormat returns the format for the point size and scale, preferring
+// the ones used by iconutil, then the modern ones.
+func appIconFormat(pt, scale uint) *Format {
+	for _, file := range iconsetFiles {
+		if f := supportedImageFormats[file.code]; f.PointSize == pt && f.Scale == scale {
+			return f
+		}
+	}
+
+	var res *Format
+	for _, f := range supportedImageFormats {
+		if f.PointSize != pt || f.Scale != scale {
+			continue
+		}
+		if res == nil || (res.legacy() && !f.legacy()) || (res.legacy() == f.legacy() && f.Code < res.Code) {
+			res = f
+		}
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestWriteAppIconset(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.RemoveByCode(CodeIc10)
+
+	dir := filepath.Join(t.TempDir(), "AppIcon.appiconset")
+	if err := i.WriteAppIconset(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "Contents.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents appIconContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []appIconImage{
+		{"icon_16x16.png", "mac", "1x", "16x16"},
+		{"icon_16x16@2x.png", "mac", "2x", "16x16"},
+		{"icon_32x32.png", "mac", "1x", "32x32"},
+		{"icon_32x32@2x.png", "mac", "2x", "32x32"},
+		{"icon_128x128.png", "mac", "1x", "128x128"},
+		{"icon_128x128@2x.png", "mac", "2x", "128x128"},
+		{"icon_256x256.png", "mac", "1x", "256x256"},
+		{"icon_256x256@2x.png", "mac", "2x", "256x256"},
+		{"icon_512x512.png", "mac", "1x", "512x512"},
+		{"", "mac", "2x", "512x512"},
+	}
+	if diff := cmp.Diff(want, contents.Images); diff != "" {
+		t.Errorf("Contents.json images mismatch (-want +got):\n%s", diff)
+	}
+	for _, img := range contents.Images {
+		if img.Filename == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFromAppIconset(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "AppIcon.appiconset")
+	if err := i.WriteAppIconset(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := FromAppIconset(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Assets) != len(i.Assets) {
+		t.Fatalf("got %d images, want %d:\n%s", len(back.Assets), len(i.Assets), back.Info())
+	}
+	for _, w := range i.Assets {
+		a, err := back.ByCode(w.Format.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utils.EqualImages(utils.Img2NRGBA(a.Image), utils.Img2NRGBA(w.Image)) {
+			t.Errorf("[%s] image modified by the round trip", CodeString(w.Format.Code))
+		}
+	}
+
+	// other idioms and sizes of the catalog
+	fsys := fstest.MapFS{
+		"Contents.json": &fstest.MapFile{Data: []byte(`{"images": [
+			{"filename": "a.png", "idiom": "mac", "scale": "1x", "size": "64x64"},
+			{"filename": "b.png", "idiom": "iphone", "scale": "2x", "size": "60x60"},
+			{"idiom": "mac", "scale": "2x", "size": "512x512"}
+		]}`)},
+		"a.png": &fstest.MapFile{Data: pngFile(t, 64)},
+	}
+	back, err = FromAppIconset(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Assets) != 1 || back.Assets[0].Format.Code != CodeIcp6 {
+		t.Errorf("unexpected images:\n%s", back.Info())
+	}
+}
+
+func pngFile(t *testing.T, size int) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
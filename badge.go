@@ -0,0 +1,98 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Anchor is the position of a badge on the icon.
+type Anchor uint8
+
+// Badge positions, the corner ones being flush with the edges of the image.
+const (
+	AnchorBottomRight Anchor = iota
+	AnchorBottomLeft
+	AnchorTopRight
+	AnchorTopLeft
+	AnchorCenter
+)
+
+// ApplyBadge composites the badge onto every image of the icon, at the provided anchor.
+// The badge is scaled so that its width is the provided fraction of the image width,
+// keeping its aspect ratio. The images are encoded again by Encode. Images that cannot be
+// decoded are left unchanged.
+func (i *ICNS) ApplyBadge(badge image.Image, anchor Anchor, scale float64) error {
+	if scale <= 0 || scale > 1 {
+		return fmt.Errorf("invalid badge scale %v", scale)
+	}
+	bb := badge.Bounds()
+	if bb.Empty() {
+		return fmt.Errorf("empty badge")
+	}
+
+	s := i.scaler
+	if s == nil {
+		s = defaultScaler
+	}
+
+	badges := make(map[image.Rectangle]*image.NRGBA)
+	for _, a := range i.Assets {
+		img, err := a.AsImage()
+		if err != nil {
+			continue // nothing to draw the badge onto
+		}
+		r := img.Bounds()
+		w := int(math.Round(float64(r.Dx()) * scale))
+		h := int(math.Round(float64(w) * float64(bb.Dy()) / float64(bb.Dx())))
+		if w == 0 || h == 0 {
+			continue
+		}
+
+		var pos image.Point
+		switch anchor {
+		case AnchorBottomRight:
+			pos = image.Pt(r.Max.X-w, r.Max.Y-h)
+		case AnchorBottomLeft:
+			pos = image.Pt(r.Min.X, r.Max.Y-h)
+		case AnchorTopRight:
+			pos = image.Pt(r.Max.X-w, r.Min.Y)
+		case AnchorTopLeft:
+			pos = r.Min
+		case AnchorCenter:
+			pos = image.Pt(r.Min.X+(r.Dx()-w)/2, r.Min.Y+(r.Dy()-h)/2)
+		default:
+			return fmt.Errorf("invalid anchor %d", anchor)
+		}
+
+		key := image.Rect(0, 0, w, h)
+		b, ok := badges[key]
+		if !ok {
+			b = image.NewNRGBA(key)
+			s.Scale(b, badge)
+			badges[key] = b
+		}
+
+		dst := image.NewNRGBA(r)
+		draw.Draw(dst, r, img, r.Min, draw.Src)
+		draw.Draw(dst, key.Add(pos), b, image.Point{}, draw.Over)
+		a.Image = dst
+		a.mask = nil // the mask of legacy images is derived from the new image
+	}
+	return nil
+}
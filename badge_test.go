@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyBadge(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for idx := 0; idx < len(src.Pix); idx += 4 {
+		copy(src.Pix[idx:], []byte{0xff, 0, 0, 0xff})
+	}
+
+	if err := i.ApplyBadge(src, AnchorBottomRight, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range i.Assets {
+		size := int(a.Format.Res)
+		for _, p := range []image.Point{{size - 1, size - 1}, {size / 2, size * 3 / 4}} {
+			if c := color.NRGBAModel.Convert(a.Image.At(p.X, p.Y)); c != red {
+				t.Errorf("[%s] %v: got %v, want the badge color", CodeString(a.Format.Code), p, c)
+			}
+		}
+		if c := color.NRGBAModel.Convert(a.Image.At(size-1, size/2-2)); c == red {
+			t.Errorf("[%s] badge above its expected area", CodeString(a.Format.Code))
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := dec.ByResolution(Pixel1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(1023, 1023)); c != red {
+		t.Errorf("badge not encoded: got %v", c)
+	}
+
+	if err := i.ApplyBadge(src, AnchorCenter, 0); err == nil {
+		t.Error("expected an error for a zero scale")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/kroksys/icns/internal/plist"
+)
+
+// FromAppBundle loads the icon of a macOS application bundle, such as os.DirFS("Foo.app"):
+// the .icns file of Contents/Resources named by the CFBundleIconFile key of Contents/Info.plist,
+// or by its CFBundleIconName key for applications using an asset catalog.
+func FromAppBundle(fsys fs.FS, opts ...DecodeOption) (*ICNS, error) {
+	data, err := fs.ReadFile(fsys, "Contents/Info.plist")
+	if err != nil {
+		return nil, err
+	}
+	info, err := plist.Strings(data)
+	if err != nil {
+		return nil, fmt.Errorf("Info.plist: %w", err)
+	}
+
+	var names []string
+	for _, key := range []string{"CFBundleIconFile", "CFBundleIconName"} {
+		name := info[key]
+		if name == "" {
+			continue
+		}
+		if path.Ext(name) == "" {
+			name += ".icns"
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no icon declared in Info.plist")
+	}
+
+	for _, name := range names {
+		f, err := fsys.Open(path.Join("Contents/Resources", name))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		return Decode(f, opts...)
+	}
+	return nil, fmt.Errorf("icon %s not found in Contents/Resources", names[0])
+}
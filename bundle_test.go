@@ -0,0 +1,98 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFromAppBundle(t *testing.T) {
+	t.Parallel()
+	icns, err := os.ReadFile("testdata/mit.icns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plist := func(key, value string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleName</key>
+	<string>Sample</string>
+	<key>` + key + `</key>
+	<string>` + value + `</string>
+</dict>
+</plist>`)}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "icon file",
+			fsys: fstest.MapFS{
+				"Contents/Info.plist":         plist("CFBundleIconFile", "mit"),
+				"Contents/Resources/mit.icns": {Data: icns},
+			},
+		},
+		{
+			name: "icon file with extension",
+			fsys: fstest.MapFS{
+				"Contents/Info.plist":         plist("CFBundleIconFile", "mit.icns"),
+				"Contents/Resources/mit.icns": {Data: icns},
+			},
+		},
+		{
+			name: "icon name",
+			fsys: fstest.MapFS{
+				"Contents/Info.plist":             plist("CFBundleIconName", "AppIcon"),
+				"Contents/Resources/AppIcon.icns": {Data: icns},
+			},
+		},
+		{
+			name: "missing icon",
+			fsys: fstest.MapFS{
+				"Contents/Info.plist": plist("CFBundleIconFile", "mit"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "no icon key",
+			fsys: fstest.MapFS{
+				"Contents/Info.plist":         plist("CFBundleIdentifier", "com.example"),
+				"Contents/Resources/mit.icns": {Data: icns},
+			},
+			wantErr: true,
+		},
+	} {
+		i, err := FromAppBundle(tc.fsys)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(i.Assets) != 10 {
+			t.Errorf("%s: unexpected icon:\n%s", tc.name, i.Info())
+		}
+	}
+}
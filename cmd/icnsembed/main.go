@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command icnsembed generates a .icns file from source art, along with a Go file
+// exposing it through a go:embed variable. It is meant to be used with go generate:
+//
+//	//go:generate go run github.com/kroksys/icns/cmd/icnsembed -pkg main art.png
+//
+// The source can be a square image (PNG, JPEG or GIF), resampled to every resolution,
+// an .iconset directory, or a .icns file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/kroksys/icns"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("icnsembed: ")
+
+	var c icns.EmbedConfig
+	flag.StringVar(&c.Package, "pkg", os.Getenv("GOPACKAGE"), "package of the generated Go file")
+	flag.StringVar(&c.Var, "var", "Icon", "name of the generated variable")
+	flag.StringVar(&c.File, "file", "icon.icns", "name of the generated .icns file")
+	out := flag.String("o", ".", "output directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: icnsembed [flags] source\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	i, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := icns.WriteEmbed(*out, i, c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// load reads the source of the icon.
+func load(path string) (*icns.ICNS, error) {
+	if st, err := os.Stat(path); err == nil && st.IsDir() {
+		return icns.FromIconset(os.DirFS(path))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".icns" {
+		return icns.Decode(f)
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return icns.FromImage(img)
+}
@@ -15,10 +15,11 @@
 package codec
 
 import (
+	"errors"
 	"image"
 	"io"
-	"io/ioutil"
 
+	"github.com/kroksys/icns/internal/pool"
 	"github.com/kroksys/icns/internal/rle"
 	"github.com/kroksys/icns/internal/utils"
 )
@@ -32,11 +33,15 @@ func (c *argbCodec) Encode(w io.Writer, img image.Image) error {
 		if _, err := w.Write([]byte(c.header)); err != nil {
 			return err
 		}
-		if _, err := w.Write(rle.Encode(utils.NRGBAChannel(nrgba, 3))); err != nil {
-			return err
-		}
-		for i := 0; i < 3; i++ {
-			if _, err := w.Write(rle.Encode(utils.NRGBAChannel(nrgba, i))); err != nil {
+		ch, enc := pool.Bytes(0), pool.Bytes(0)
+		defer func() {
+			pool.PutBytes(ch)
+			pool.PutBytes(enc)
+		}()
+		for _, i := range []int{3, 0, 1, 2} {
+			ch = utils.AppendNRGBAChannel(ch[:0], nrgba, i)
+			enc = rle.AppendEncode(enc[:0], ch)
+			if _, err := w.Write(enc); err != nil {
 				return err
 			}
 		}
@@ -46,14 +51,23 @@ func (c *argbCodec) Encode(w io.Writer, img image.Image) error {
 }
 
 func (c *argbCodec) Decode(r io.Reader, res Resolution) (image.Image, string, error) {
-	body, err := ioutil.ReadAll(r)
+	buf, err := readAll(r)
 	if err != nil {
 		return nil, "", err
 	}
+	defer pool.PutBuffer(buf)
+	body := buf.Bytes()
 
-	flat := rle.Decode(body[len(c.header):]) // skip header
-
+	if len(body) < len(c.header) {
+		return nil, "", errors.New("argb data too short")
+	}
 	size := int(res * res)
+	flat, err := rle.AppendDecodeN(pool.Bytes(0), body[len(c.header):], 4*size) // skip header
+	if err != nil {
+		return nil, "", err
+	}
+	defer pool.PutBytes(flat)
+
 	pixels := make([]byte, 4*size)
 	for i := 0; i < size; i++ {
 		pixels[i*4] = flat[size+i]
@@ -71,6 +85,8 @@ func (c *argbCodec) Decode(r io.Reader, res Resolution) (image.Image, string, er
 	return img, "argb", nil
 }
 
+// ARGBCodec stores the RLE-packed alpha, red, green and blue channels of an image,
+// preceded by "ARGB", as used by ic04 and ic05.
 var ARGBCodec = &argbCodec{
 	header: "ARGB",
 }
@@ -0,0 +1,102 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/kroksys/icns/codec"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{uint8(x * 16), uint8(y * 16), 0x80, 0xff})
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		c        codec.Codec
+		encoding string
+		alpha    bool // whether only the alpha channel is kept
+	}{
+		{"image", codec.ImageCodec, "png", false},
+		{"argb", codec.ARGBCodec, "argb", false},
+		{"pack", codec.PackCodec, "icon", false},
+		{"it32", codec.It32Codec, "icon", false},
+		{"mask", codec.MaskCodec, "mask", true},
+	} {
+		buf := new(bytes.Buffer)
+		if err := tc.c.Encode(buf, src); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		img, enc, err := tc.c.Decode(buf, 16)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if enc != tc.encoding {
+			t.Errorf("%s: got encoding %q, want %q", tc.name, enc, tc.encoding)
+		}
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				want := color.Color(src.NRGBAAt(x, y))
+				if tc.alpha {
+					want = color.Alpha{src.NRGBAAt(x, y).A}
+				}
+				wr, wg, wb, wa := want.RGBA()
+				gr, gg, gb, ga := img.At(x, y).RGBA()
+				if [4]uint32{wr, wg, wb, wa} != [4]uint32{gr, gg, gb, ga} {
+					t.Fatalf("%s: (%d, %d): got %v, want %v", tc.name, x, y, img.At(x, y), want)
+				}
+			}
+		}
+	}
+
+	if _, _, err := codec.PackCodec.Decode(bytes.NewReader([]byte{0x00}), 16); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
+
+func TestResolutionText(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		text string
+		want codec.Resolution
+		ok   bool
+	}{
+		{"256", 256, true},
+		{"32x32", 32, true},
+		{"16x32", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"big", 0, false},
+	} {
+		var r codec.Resolution
+		err := r.UnmarshalText([]byte(tc.text))
+		if (err == nil) != tc.ok || r != tc.want {
+			t.Errorf("%q: got %d, %v", tc.text, r, err)
+		}
+	}
+
+	if text, err := codec.Resolution(512).MarshalText(); err != nil || string(text) != "512" {
+		t.Errorf("got %q, %v, want 512", text, err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codec implements the storage of the images of .icns files: the PNG and
+// JPEG data of modern formats, and the RLE-packed channels and 8-bit masks of legacy ones.
+// Codecs can be reused by tools reading or writing these elements, and supplied to
+// icns.RegisterFormat for additional icon types.
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kroksys/icns/internal/pool"
+)
+
+// Resolution is the width and height of an icon image, in pixels.
+type Resolution uint
+
+func (r Resolution) String() string {
+	return strconv.FormatUint(uint64(r), 10)
+}
+
+// MarshalText implements encoding.TextMarshaler, writing the number of pixels.
+func (r Resolution) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts a number of pixels,
+// such as "256", optionally repeated as width and height, such as "256x256".
+func (r *Resolution) UnmarshalText(text []byte) error {
+	s := string(text)
+	if w, h, ok := strings.Cut(s, "x"); ok {
+		if w != h {
+			return fmt.Errorf("resolution %q is not square", s)
+		}
+		s = w
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || v == 0 {
+		return fmt.Errorf("invalid resolution %q", text)
+	}
+	*r = Resolution(v)
+	return nil
+}
+
+// Set implements flag.Value, as UnmarshalText does.
+func (r *Resolution) Set(s string) error {
+	return r.UnmarshalText([]byte(s))
+}
+
+// Codec reads and writes the data of a single icon type, excluding its element header.
+//
+// Encode writes img, which has the resolution of the icon type. Decode reads an image
+// of the provided resolution, which codecs storing their own dimensions may ignore, and
+// returns it along with a short name of its encoding, such as "png".
+// Codecs must be safe for concurrent use.
+type Codec interface {
+	Encode(w io.Writer, img image.Image) error
+	Decode(r io.Reader, res Resolution) (img image.Image, encoding string, err error)
+}
+
+// readAll reads the content of r into a pooled buffer, to be released with pool.PutBuffer.
+func readAll(r io.Reader) (*bytes.Buffer, error) {
+	buf := pool.Buffer()
+	if _, err := buf.ReadFrom(r); err != nil {
+		pool.PutBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/kroksys/icns/internal/pool"
+)
+
+// ImageFormat encodes and decodes the data of a single image format, such as PNG.
+// It allows replacing the implementations of the standard library used by the image
+// codecs, for instance with faster encoders. Implementations must be safe for concurrent use.
+type ImageFormat interface {
+	Encode(w io.Writer, img image.Image) error
+	Decode(r io.Reader) (image.Image, error)
+}
+
+type pngFormat struct {
+	e *png.Encoder
+}
+
+func (f pngFormat) Encode(w io.Writer, img image.Image) error {
+	return f.e.Encode(w, img)
+}
+
+func (pngFormat) Decode(r io.Reader) (image.Image, error) {
+	return png.Decode(r)
+}
+
+// PNG returns the PNG format of the standard library, encoding with e, or the
+// default settings if nil. Encoders without a BufferPool share the buffers of the codecs.
+func PNG(e *png.Encoder) ImageFormat {
+	if e == nil {
+		e = &png.Encoder{}
+	}
+	if e.BufferPool == nil {
+		e = &png.Encoder{CompressionLevel: e.CompressionLevel, BufferPool: pool.PNG}
+	}
+	return pngFormat{e: e}
+}
+
+type jpegFormat struct {
+	o *jpeg.Options
+}
+
+func (f jpegFormat) Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, f.o)
+}
+
+func (jpegFormat) Decode(r io.Reader) (image.Image, error) {
+	return jpeg.Decode(r)
+}
+
+// JPEG returns the JPEG format of the standard library, encoding with the provided
+// quality (1 to 100), or the default one if 0.
+func JPEG(quality int) ImageFormat {
+	var o *jpeg.Options
+	if quality > 0 {
+		o = &jpeg.Options{Quality: quality}
+	}
+	return jpegFormat{o: o}
+}
+
+var (
+	defaultPNG  = PNG(nil)
+	defaultJPEG = JPEG(0)
+)
+
+type imageCodec struct {
+	jpeg       bool        // encode as JPEG rather than PNG
+	pngFormat  ImageFormat // default if nil
+	jpegFormat ImageFormat // default if nil
+}
+
+func (c *imageCodec) formats() (p, j ImageFormat) {
+	p, j = c.pngFormat, c.jpegFormat
+	if p == nil {
+		p = defaultPNG
+	}
+	if j == nil {
+		j = defaultJPEG
+	}
+	return p, j
+}
+
+func (c *imageCodec) Encode(w io.Writer, img image.Image) error {
+	p, j := c.formats()
+	if c.jpeg {
+		return j.Encode(w, img)
+	}
+	return p.Encode(w, img)
+}
+
+func (c *imageCodec) Decode(r io.Reader, _ Resolution) (image.Image, string, error) {
+	// we might have to re-read.
+	buf, err := readAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	defer pool.PutBuffer(buf)
+	p, j := c.formats()
+	reader := bytes.NewReader(buf.Bytes())
+	if img, err := j.Decode(reader); err == nil {
+		return img, "jpeg", nil
+	}
+	_, _ = reader.Seek(0, io.SeekStart)
+	img, err := p.Decode(reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, "png", nil
+}
+
+// ImageCodec decodes JPEG and PNG data, and encodes as PNG.
+var ImageCodec = &imageCodec{}
+
+// JPEGCodec decodes JPEG and PNG data, and encodes as JPEG.
+var JPEGCodec = &imageCodec{
+	jpeg: true,
+}
+
+// PNGFormatCodec returns a codec like ImageCodec, using the provided formats
+// instead of the standard library, unless nil.
+func PNGFormatCodec(pngFormat, jpegFormat ImageFormat) Codec {
+	return &imageCodec{
+		pngFormat:  pngFormat,
+		jpegFormat: jpegFormat,
+	}
+}
+
+// JPEGFormatCodec returns a codec like JPEGCodec, using the provided formats
+// instead of the standard library, unless nil.
+func JPEGFormatCodec(pngFormat, jpegFormat ImageFormat) Codec {
+	return &imageCodec{
+		jpeg:       true,
+		pngFormat:  pngFormat,
+		jpegFormat: jpegFormat,
+	}
+}
+
+// PNGCodec returns a codec like ImageCodec, encoding with the provided compression level.
+func PNGCodec(level png.CompressionLevel) Codec {
+	return PNGEncoderCodec(&png.Encoder{CompressionLevel: level})
+}
+
+// PNGEncoderCodec returns a codec like ImageCodec, encoding with the provided encoder,
+// such as one with a BufferPool shared with other encoders.
+func PNGEncoderCodec(e *png.Encoder) Codec {
+	return PNGFormatCodec(PNG(e), nil)
+}
+
+// JPEGQualityCodec returns a codec like JPEGCodec, encoding with the provided quality (1 to 100).
+func JPEGQualityCodec(quality int) Codec {
+	return JPEGFormatCodec(nil, JPEG(quality))
+}
@@ -15,10 +15,12 @@
 package codec
 
 import (
+	"fmt"
 	"image"
 	"io"
 	"io/ioutil"
 
+	"github.com/kroksys/icns/internal/pool"
 	"github.com/kroksys/icns/internal/utils"
 )
 
@@ -26,7 +28,8 @@ type maskCodec struct{}
 
 func (c *maskCodec) Encode(w io.Writer, img image.Image) error {
 	if nrgba, ok := img.(*image.NRGBA); ok {
-		alpha := utils.NRGBAChannel(nrgba, 3)
+		alpha := utils.AppendNRGBAChannel(pool.Bytes(0), nrgba, 3)
+		defer pool.PutBytes(alpha)
 		if _, err := w.Write(alpha); err != nil {
 			return err
 		}
@@ -42,6 +45,9 @@ func (c *maskCodec) Decode(r io.Reader, res Resolution) (image.Image, string, er
 	}
 
 	rect := image.Rect(0, 0, int(res), int(res))
+	if len(body) != rect.Dx()*rect.Dy() {
+		return nil, "", fmt.Errorf("unexpected mask size: got %d bytes, want %d", len(body), rect.Dx()*rect.Dy())
+	}
 	img := &image.Alpha{
 		Pix:    body,
 		Stride: 1 * rect.Dx(),
@@ -50,4 +56,6 @@ func (c *maskCodec) Decode(r io.Reader, res Resolution) (image.Image, string, er
 	return img, "mask", nil
 }
 
+// MaskCodec stores the alpha channel of an image, one byte per pixel, as used by
+// the masks of legacy icon types such as s8mk. It decodes to an *image.Alpha.
 var MaskCodec = &maskCodec{}
@@ -15,21 +15,33 @@
 package codec
 
 import (
+	"errors"
 	"image"
 	"io"
-	"io/ioutil"
 
+	"github.com/kroksys/icns/internal/pool"
 	"github.com/kroksys/icns/internal/rle"
 	"github.com/kroksys/icns/internal/utils"
 )
 
-type packCodec struct{}
+type packCodec struct {
+	header []byte
+}
 
 func (c *packCodec) Encode(w io.Writer, img image.Image) error {
 	if nrgba, ok := img.(*image.NRGBA); ok {
+		if _, err := w.Write(c.header); err != nil {
+			return err
+		}
+		ch, enc := pool.Bytes(0), pool.Bytes(0)
+		defer func() {
+			pool.PutBytes(ch)
+			pool.PutBytes(enc)
+		}()
 		for i := 0; i < 3; i++ {
-			c := utils.NRGBAChannel(nrgba, i)
-			if _, err := w.Write(rle.Encode(c)); err != nil {
+			ch = utils.AppendNRGBAChannel(ch[:0], nrgba, i)
+			enc = rle.AppendEncode(enc[:0], ch)
+			if _, err := w.Write(enc); err != nil {
 				return err
 			}
 		}
@@ -39,14 +51,23 @@ func (c *packCodec) Encode(w io.Writer, img image.Image) error {
 }
 
 func (c *packCodec) Decode(r io.Reader, res Resolution) (image.Image, string, error) {
-	body, err := ioutil.ReadAll(r)
+	buf, err := readAll(r)
 	if err != nil {
 		return nil, "", err
 	}
+	defer pool.PutBuffer(buf)
+	body := buf.Bytes()
 
-	flat := rle.Decode(body)
-
+	if len(body) < len(c.header) {
+		return nil, "", errors.New("icon data too short")
+	}
 	size := int(res * res)
+	flat, err := rle.AppendDecodeN(pool.Bytes(0), body[len(c.header):], 3*size) // skip header
+	if err != nil {
+		return nil, "", err
+	}
+	defer pool.PutBytes(flat)
+
 	pixels := make([]byte, 4*size)
 	for i := 0; i < size; i++ {
 		pixels[i*4] = flat[i]
@@ -64,4 +85,12 @@ func (c *packCodec) Decode(r io.Reader, res Resolution) (image.Image, string, er
 	return img, "icon", nil
 }
 
+// PackCodec stores the RLE-packed red, green and blue channels of an image, as used
+// by is32, il32 and ih32. Their alpha channel is stored separately, with MaskCodec.
 var PackCodec = &packCodec{}
+
+// It32Codec is the variant of PackCodec used by it32, whose data is
+// preceded by 4 zero bytes.
+var It32Codec = &packCodec{
+	header: []byte{0, 0, 0, 0},
+}
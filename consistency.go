@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+)
+
+// CheckConsistency compares every image of the icon to its largest one, scaled down to
+// the same resolution with the scaler of the icon, and reports as warnings the images
+// that differ by more than maxDelta. The difference is the mean of the absolute
+// differences of the color and alpha channels, from 0 for identical images to 1;
+// images drawn for the same artwork usually differ by less than 0.05, small ones
+// being hinted. This flags icons whose large images were updated but not the small ones.
+func (i *ICNS) CheckConsistency(maxDelta float64) []Finding {
+	ref, err := i.highestResolutionAsset()
+	if err != nil {
+		return nil
+	}
+	src, err := ref.AsImage()
+	if err != nil {
+		return []Finding{{Severity: SeverityError, Code: ref.Format.Code, Message: err.Error()}}
+	}
+
+	var res []Finding
+	scaled := make(map[Resolution]image.Image)
+	for _, a := range i.Assets {
+		if a == ref {
+			continue
+		}
+		img, err := a.AsImage()
+		if err != nil {
+			res = append(res, Finding{Severity: SeverityError, Code: a.Format.Code, Message: err.Error()})
+			continue
+		}
+		want, ok := scaled[a.Format.Res]
+		if !ok {
+			want = i.resize(src, a.Format.Res)
+			scaled[a.Format.Res] = want
+		}
+		if d := meanDelta(img, want); d > maxDelta {
+			res = append(res, Finding{
+				Severity: SeverityWarning,
+				Code:     a.Format.Code,
+				Message:  fmt.Sprintf("image differs by %.1f%% from the %dpx image scaled down", 100*d, ref.Format.Res),
+			})
+		}
+	}
+	return res
+}
+
+// meanDelta returns the mean absolute difference of the channels of two images,
+// from 0 to 1. Images of different sizes differ by 1.
+func meanDelta(x, y image.Image) float64 {
+	bx, by := x.Bounds(), y.Bounds()
+	if bx.Size() != by.Size() || bx.Empty() {
+		return 1
+	}
+	abs := func(a, b uint32) uint64 {
+		if a > b {
+			return uint64(a - b)
+		}
+		return uint64(b - a)
+	}
+	var sum uint64
+	for dy := 0; dy < bx.Dy(); dy++ {
+		for dx := 0; dx < bx.Dx(); dx++ {
+			r1, g1, b1, a1 := x.At(bx.Min.X+dx, bx.Min.Y+dy).RGBA()
+			r2, g2, b2, a2 := y.At(by.Min.X+dx, by.Min.Y+dy).RGBA()
+			sum += abs(r1, r2) + abs(g1, g2) + abs(b1, b2) + abs(a1, a2)
+		}
+	}
+	return float64(sum) / float64(4*0xffff*bx.Dx()*bx.Dy())
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := i.CheckConsistency(0.05); got != nil {
+		t.Errorf("unexpected findings: %v", got)
+	}
+
+	// outdated artwork for 32pt@1x
+	old := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(old, old.Bounds(), image.NewUniform(color.NRGBA{B: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	a, _ := i.ByCode(CodeIc05)
+	a.Image = old
+
+	got := i.CheckConsistency(0.05)
+	if len(got) != 1 || got[0].Code != CodeIc05 || got[0].Severity != SeverityWarning {
+		t.Fatalf("unexpected findings: %v", got)
+	}
+	if !strings.Contains(got[0].Message, "1024px") {
+		t.Errorf("unexpected message: %s", got[0].Message)
+	}
+	if got := NewICNS().CheckConsistency(0); got != nil {
+		t.Errorf("unexpected findings for an empty icon: %v", got)
+	}
+}
@@ -14,34 +14,48 @@
 
 package icns
 
-import "github.com/kroksys/icns/internal/codec"
+import (
+	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/kroksys/icns/codec"
+)
+
+const magic uint32 = ('i'<<24 | 'c'<<16 | 'n'<<8 | 's')
+
+// OSType codes of the known icon types.
 const (
-	magic uint32 = ('i'<<24 | 'c'<<16 | 'n'<<8 | 's')
-	is32  uint32 = ('i'<<24 | 's'<<16 | '3'<<8 | '2')
-	s8mk  uint32 = ('s'<<24 | '8'<<16 | 'm'<<8 | 'k')
-	il32  uint32 = ('i'<<24 | 'l'<<16 | '3'<<8 | '2')
-	l8mk  uint32 = ('l'<<24 | '8'<<16 | 'm'<<8 | 'k')
-	ih32  uint32 = ('i'<<24 | 'h'<<16 | '3'<<8 | '2')
-	h8mk  uint32 = ('h'<<24 | '8'<<16 | 'm'<<8 | 'k')
-	it32  uint32 = ('i'<<24 | 't'<<16 | '3'<<8 | '2')
-	t8mk  uint32 = ('t'<<24 | '8'<<16 | 'm'<<8 | 'k')
-	icp4  uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '4')
-	icp5  uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '5')
-	icp6  uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '6')
-	ic04  uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '4')
-	ic05  uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '5')
-	ic07  uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '7')
-	ic08  uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '8')
-	ic09  uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '9')
-	ic10  uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '0')
-	ic11  uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '1')
-	ic12  uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '2')
-	ic13  uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '3')
-	ic14  uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '4')
+	CodeIs32 uint32 = ('i'<<24 | 's'<<16 | '3'<<8 | '2')
+	CodeS8mk uint32 = ('s'<<24 | '8'<<16 | 'm'<<8 | 'k')
+	CodeIl32 uint32 = ('i'<<24 | 'l'<<16 | '3'<<8 | '2')
+	CodeL8mk uint32 = ('l'<<24 | '8'<<16 | 'm'<<8 | 'k')
+	CodeIh32 uint32 = ('i'<<24 | 'h'<<16 | '3'<<8 | '2')
+	CodeH8mk uint32 = ('h'<<24 | '8'<<16 | 'm'<<8 | 'k')
+	CodeIt32 uint32 = ('i'<<24 | 't'<<16 | '3'<<8 | '2')
+	CodeT8mk uint32 = ('t'<<24 | '8'<<16 | 'm'<<8 | 'k')
+	CodeIcp4 uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '4')
+	CodeIcp5 uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '5')
+	CodeIcp6 uint32 = ('i'<<24 | 'c'<<16 | 'p'<<8 | '6')
+	CodeIc04 uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '4')
+	CodeIc05 uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '5')
+	CodeIc07 uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '7')
+	CodeIc08 uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '8')
+	CodeIc09 uint32 = ('i'<<24 | 'c'<<16 | '0'<<8 | '9')
+	CodeIc10 uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '0')
+	CodeIc11 uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '1')
+	CodeIc12 uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '2')
+	CodeIc13 uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '3')
+	CodeIc14 uint32 = ('i'<<24 | 'c'<<16 | '1'<<8 | '4')
+
+	// CodeTOC is the table of contents, listing the code and size of the other elements.
+	CodeTOC uint32 = ('T'<<24 | 'O'<<16 | 'C'<<8 | ' ')
+	// CodeDark is a nested icon, used with the dark appearance.
+	CodeDark uint32 = 0xFDD92FA8
 )
 
-func codeRepr(c uint32) string {
+// CodeString returns the 4 character representation of an OSType code, such as "ic07".
+func CodeString(c uint32) string {
 	r := []rune{
 		rune(c >> 24 & 0xff),
 		rune(c >> 16 & 0xff),
@@ -51,6 +65,23 @@ func codeRepr(c uint32) string {
 	return string(r)
 }
 
+// CodeFromString parses the 4 character representation of an OSType code, such as "ic07".
+func CodeFromString(s string) (uint32, error) {
+	r := []rune(s)
+	if len(r) != 4 {
+		return 0, fmt.Errorf("invalid code %q: must be 4 characters long", s)
+	}
+
+	var c uint32
+	for _, x := range r {
+		if x > 0xff {
+			return 0, fmt.Errorf("invalid code %q: unexpected character %q", s, x)
+		}
+		c = c<<8 | uint32(x)
+	}
+	return c, nil
+}
+
 // Resolution represents the supported resolutions in pixels.
 type Resolution = codec.Resolution
 
@@ -85,3 +116,112 @@ const (
 	// Oldest version
 	Oldest Compatibility = Allegro
 )
+
+var compatibilityNames = []string{
+	Allegro:      "allegro",
+	Cheetah:      "cheetah",
+	Leopard:      "leopard",
+	Lion:         "lion",
+	MountainLion: "mountainlion",
+}
+
+func (c Compatibility) String() string {
+	if int(c) < len(compatibilityNames) {
+		return compatibilityNames[c]
+	}
+	return fmt.Sprintf("Compatibility(%d)", int(c))
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name returned by String.
+func (c Compatibility) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts the names returned
+// by String, in any case, as well as "oldest" and "newest".
+func (c *Compatibility) UnmarshalText(text []byte) error {
+	s := strings.ToLower(string(text))
+	switch s {
+	case "oldest":
+		*c = Oldest
+		return nil
+	case "newest":
+		*c = Newest
+		return nil
+	}
+	for v, name := range compatibilityNames {
+		if s == name {
+			*c = Compatibility(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown compatibility %q", text)
+}
+
+// Set implements flag.Value, as UnmarshalText does.
+func (c *Compatibility) Set(s string) error {
+	return c.UnmarshalText([]byte(s))
+}
+
+// compatibilityVersions holds the major and minor version of the OS releases.
+var compatibilityVersions = [][2]int{
+	Allegro:      {8, 5},
+	Cheetah:      {10, 0},
+	Leopard:      {10, 5},
+	Lion:         {10, 7},
+	MountainLion: {10, 8},
+}
+
+// Version returns the version of the OS release, such as "10.7" for Lion.
+func (c Compatibility) Version() string {
+	if int(c) >= len(compatibilityVersions) {
+		return ""
+	}
+	v := compatibilityVersions[c]
+	return fmt.Sprintf("%d.%d", v[0], v[1])
+}
+
+// CompatibilityForVersion returns the newest compatibility supported by the provided
+// version of macOS, such as "10.6" or "macOS 12.1", or of its kernel, such as "darwin 21.2".
+// For instance, "10.6" returns Leopard, and versions from 10.8 on return MountainLion.
+func CompatibilityForVersion(version string) (Compatibility, error) {
+	s := strings.TrimSpace(strings.ToLower(version))
+	darwin := strings.HasPrefix(s, "darwin")
+	if darwin {
+		s = strings.TrimSpace(strings.TrimPrefix(s, "darwin"))
+	}
+	for _, prefix := range []string{"macos", "mac os x", "os x"} {
+		s = strings.TrimSpace(strings.TrimPrefix(s, prefix))
+	}
+
+	parts := strings.SplitN(s, ".", 3)
+	var v [2]int
+	for idx := 0; idx < len(v) && idx < len(parts); idx++ {
+		n, err := strconv.Atoi(parts[idx])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid version %q", version)
+		}
+		v[idx] = n
+	}
+	if darwin {
+		// Darwin 5 to 19 are Mac OS X 10.1 to 10.15, and Darwin 20 is macOS 11.
+		switch {
+		case v[0] >= 20:
+			v = [2]int{v[0] - 9, 0}
+		case v[0] >= 5:
+			v = [2]int{10, v[0] - 4}
+		default:
+			v = [2]int{10, 0}
+		}
+	}
+
+	for c := Newest; ; c-- {
+		min := compatibilityVersions[c]
+		if v[0] > min[0] || (v[0] == min[0] && v[1] >= min[1]) {
+			return c, nil
+		}
+		if c == Oldest {
+			return 0, fmt.Errorf("version %q predates the supported ones", version)
+		}
+	}
+}
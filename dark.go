@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+)
+
+// Dark returns the icon used with the dark appearance, or nil if there is none.
+func (i *ICNS) Dark() *ICNS {
+	return i.dark
+}
+
+// SetDark sets the icon used with the dark appearance, which is stored nested
+// in the file by Encode. A nil icon removes it.
+func (i *ICNS) SetDark(d *ICNS) {
+	i.dark = d
+}
+
+// ColorTransform maps a color of a light appearance image to the dark appearance.
+type ColorTransform func(color.NRGBA) color.NRGBA
+
+// luma returns the perceived brightness of the color.
+func luma(c color.NRGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
+
+// InvertLuminance inverts the brightness of colors, keeping their hue.
+func InvertLuminance(c color.NRGBA) color.NRGBA {
+	d := 0xff - 2*luma(c)
+	shift := func(v uint8) uint8 {
+		return uint8(min(max(int(v)+d, 0), 0xff))
+	}
+	return color.NRGBA{R: shift(c.R), G: shift(c.G), B: shift(c.B), A: c.A}
+}
+
+// Desaturate replaces colors with the gray of the same brightness.
+func Desaturate(c color.NRGBA) color.NRGBA {
+	y := uint8(luma(c))
+	return color.NRGBA{R: y, G: y, B: y, A: c.A}
+}
+
+// DeriveDark sets the icon used with the dark appearance to the images of the icon,
+// with their colors mapped by the provided transform, such as InvertLuminance.
+func (i *ICNS) DeriveDark(t ColorTransform) {
+	dark := NewICNS(WithMinCompatibility(i.minCompat), WithMaxCompatibility(i.maxCompat))
+	for _, a := range i.Assets {
+		src, err := a.AsImage()
+		if err != nil {
+			continue // no image to derive from
+		}
+		b := src.Bounds()
+		img := image.NewNRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				img.SetNRGBA(x, y, t(color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)))
+			}
+		}
+		dark.Assets = append(dark.Assets, &Img{
+			Image:    img,
+			Format:   a.Format,
+			Encoding: a.Encoding,
+		})
+	}
+	i.dark = dark
+}
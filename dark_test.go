@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDeriveDark(t *testing.T) {
+	t.Parallel()
+	white := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80}
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for idx := 0; idx < len(src.Pix); idx += 4 {
+		copy(src.Pix[idx:], []byte{white.R, white.G, white.B, white.A})
+	}
+
+	i := NewICNS(WithMinCompatibility(Lion))
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	i.DeriveDark(InvertLuminance)
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithTOC()); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf, WithStrictDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.UnsupportedChunks()) != 0 {
+		t.Errorf("dark icon read as an unsupported element")
+	}
+
+	dark := dec.Dark()
+	if dark == nil {
+		t.Fatal("no dark icon after decoding")
+	}
+	if len(dark.Assets) != len(i.Assets) {
+		t.Fatalf("unexpected dark icon:\n%s", dark.Info())
+	}
+	for _, a := range dark.Assets {
+		want := color.NRGBA{A: 0x80}
+		if got := color.NRGBAModel.Convert(a.Image.At(5, 5)); got != want {
+			t.Errorf("[%s] got %v, want %v", CodeString(a.Format.Code), got, want)
+		}
+	}
+
+	dec.SetDark(nil)
+	buf.Reset()
+	if err := Encode(buf, dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec, err = Decode(buf); err != nil {
+		t.Fatal(err)
+	} else if dec.Dark() != nil {
+		t.Error("dark icon not removed")
+	}
+}
+
+func TestColorTransforms(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name string
+		t    ColorTransform
+		in   color.NRGBA
+		want color.NRGBA
+	}{
+		{"invert white", InvertLuminance, color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.NRGBA{0, 0, 0, 0xff}},
+		{"invert black", InvertLuminance, color.NRGBA{0, 0, 0, 0x10}, color.NRGBA{0xff, 0xff, 0xff, 0x10}},
+		{"invert gray", InvertLuminance, color.NRGBA{0x40, 0x40, 0x40, 0xff}, color.NRGBA{0xbf, 0xbf, 0xbf, 0xff}},
+		{"desaturate", Desaturate, color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0x4c, 0x4c, 0x4c, 0xff}},
+	} {
+		if got := tc.t(tc.in); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/kroksys/icns/internal/binary"
+)
+
+// Decoder reads successive .icns files from a stream. Unlike Decode, it reads each
+// file up to the size announced by its header, instead of until the end of the stream,
+// and it can be reset to decode another stream with the same options, so that decoders
+// can be pooled.
+//
+// The content of each file is owned by the icon decoded from it, whose elements share
+// its memory: the buffer a file is read into is never reused for the next one.
+type Decoder struct {
+	r    io.Reader
+	opts decodeOptions
+	hdr  [8]byte
+}
+
+// maxPrealloc is the largest buffer allocated for a file before reading it.
+const maxPrealloc = 1 << 20
+
+// NewDecoder returns a decoder reading from r.
+func NewDecoder(r io.Reader, opts ...DecodeOption) *Decoder {
+	d := &Decoder{r: r}
+	for _, opt := range opts {
+		opt(&d.opts)
+	}
+	return d
+}
+
+// Reset makes the decoder read from r, keeping its options.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r = r
+}
+
+// Decode reads the next file from the stream. It returns io.EOF when the stream
+// ends before the next file.
+func (d *Decoder) Decode() (*ICNS, error) {
+	if _, err := io.ReadFull(d.r, d.hdr[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("cannot read ICNS header: %w", eofErr(err))
+	}
+	hdr := binary.Reader(d.hdr[:])
+	if m, _ := hdr.Uint32(); m != magic {
+		return nil, fmt.Errorf("wrong magic number for ICNS file: %x", m)
+	}
+	size, _ := hdr.Uint32()
+	if size < 8 {
+		return nil, fmt.Errorf("invalid ICNS file size %d", size)
+	}
+	if max := d.opts.limits.MaxFileSize; max > 0 && int64(size) > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: int64(size), Max: max}
+	}
+
+	// The announced size is not trusted for the allocation: the buffer grows
+	// with the data actually read.
+	n := int64(size) - 8
+	buf := bytes.NewBuffer(make([]byte, 0, 8+min(n, maxPrealloc)))
+	buf.Write(d.hdr[:])
+	if read, err := buf.ReadFrom(io.LimitReader(d.r, n)); err != nil || read < n {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("cannot read ICNS file of %d bytes: %w", size, err)
+	}
+	return readICNS(buf.Bytes(), d.opts)
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+	data, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(append(append([]byte(nil), data...), data...)))
+	for n := 0; n < 2; n++ {
+		got, err := d.Decode()
+		if err != nil {
+			t.Fatalf("icon %d: %v", n, err)
+		}
+		if diff := cmp.Diff(want.Info(), got.Info()); diff != "" {
+			t.Errorf("icon %d: unexpected icon (-want +got):\n%s", n, diff)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+
+	d.Reset(bytes.NewReader(data[:len(data)-1]))
+	if _, err := d.Decode(); err == nil || err == io.EOF {
+		t.Errorf("got %v, want an error for a truncated file", err)
+	}
+	d.Reset(bytes.NewReader(data[:4]))
+	if _, err := d.Decode(); err == nil || err == io.EOF {
+		t.Errorf("got %v, want an error for a truncated header", err)
+	}
+
+	d.Reset(bytes.NewReader([]byte("icns\xff\xff\xff\xff")))
+	if _, err := d.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want io.ErrUnexpectedEOF for a file shorter than announced", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(data), WithLimits(Limits{MaxFileSize: 100}))
+	if _, err := d.Decode(); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+}
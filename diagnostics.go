@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DiagnosticKind classifies the problems collected while decoding.
+type DiagnosticKind int
+
+const (
+	// DiagnosticUnknownCode reports an element whose code is not supported.
+	DiagnosticUnknownCode DiagnosticKind = iota
+	// DiagnosticCodecError reports an element whose data could not be decoded.
+	DiagnosticCodecError
+	// DiagnosticMaskPairing reports a legacy image or mask missing its counterpart.
+	DiagnosticMaskPairing
+	// DiagnosticSkipped reports an element that was ignored for any other reason.
+	DiagnosticSkipped
+	// DiagnosticDimensionMismatch reports an image whose size differs from its format.
+	DiagnosticDimensionMismatch
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case DiagnosticUnknownCode:
+		return "unknown code"
+	case DiagnosticCodecError:
+		return "codec error"
+	case DiagnosticMaskPairing:
+		return "mask pairing"
+	case DiagnosticSkipped:
+		return "skipped"
+	case DiagnosticDimensionMismatch:
+		return "dimension mismatch"
+	}
+	return fmt.Sprintf("DiagnosticKind(%d)", int(k))
+}
+
+// Diagnostic is a single problem encountered while decoding.
+type Diagnostic struct {
+	Kind   DiagnosticKind
+	Code   uint32
+	Offset int // offset of the element header in the file
+	Err    error
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("[%s] %s at offset %d: %v", CodeString(d.Code), d.Kind, d.Offset, d.Err)
+}
+
+// Diagnostics collects the problems encountered while decoding, which are otherwise
+// silently ignored. See WithDiagnostics.
+type Diagnostics struct {
+	Entries []Diagnostic
+}
+
+// WithDiagnostics records into d every problem encountered by Decode.
+func WithDiagnostics(d *Diagnostics) DecodeOption {
+	return func(o *decodeOptions) {
+		o.diag = d
+	}
+}
+
+func (d *Diagnostics) add(kind DiagnosticKind, code uint32, offset int, err error) {
+	if d == nil {
+		return
+	}
+	d.Entries = append(d.Entries, Diagnostic{
+		Kind:   kind,
+		Code:   code,
+		Offset: offset,
+		Err:    err,
+	})
+}
+
+func (d *Diagnostics) String() string {
+	buf := new(bytes.Buffer)
+	for _, e := range d.Entries {
+		fmt.Fprintln(buf, e)
+	}
+	return buf.String()
+}
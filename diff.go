@@ -0,0 +1,150 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+// ChangeKind classifies the differences reported by Diff.
+type ChangeKind int
+
+const (
+	// ChangeAdded reports an element only present in the second icon.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved reports an element only present in the first icon.
+	ChangeRemoved
+	// ChangeModified reports an element present in both icons with different content.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single difference between two icons.
+type Change struct {
+	Kind ChangeKind
+	Code uint32
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("[%s] %s", CodeString(c.Code), c.Kind)
+}
+
+// Diff returns the changes from one icon to another, in their images, unsupported
+// elements and dark icons, ordered by code. Images read from a file and left unmodified
+// are compared by the SHA-256 digest of their data, and other ones by their pixels.
+func Diff(from, to *ICNS) []Change {
+	var res []Change
+	olds := assetsByCode(from)
+	news := assetsByCode(to)
+	for code, a := range olds {
+		b, ok := news[code]
+		switch {
+		case !ok:
+			res = append(res, Change{Kind: ChangeRemoved, Code: code})
+		case !sameAsset(a, b):
+			res = append(res, Change{Kind: ChangeModified, Code: code})
+		}
+	}
+	for code := range news {
+		if _, ok := olds[code]; !ok {
+			res = append(res, Change{Kind: ChangeAdded, Code: code})
+		}
+	}
+
+	oldChunks := chunksByCode(from.unsupported)
+	newChunks := chunksByCode(to.unsupported)
+	for code, data := range oldChunks {
+		d, ok := newChunks[code]
+		switch {
+		case !ok:
+			res = append(res, Change{Kind: ChangeRemoved, Code: code})
+		case !bytes.Equal(data, d):
+			res = append(res, Change{Kind: ChangeModified, Code: code})
+		}
+	}
+	for code := range newChunks {
+		if _, ok := oldChunks[code]; !ok {
+			res = append(res, Change{Kind: ChangeAdded, Code: code})
+		}
+	}
+
+	switch {
+	case from.dark == nil && to.dark != nil:
+		res = append(res, Change{Kind: ChangeAdded, Code: CodeDark})
+	case from.dark != nil && to.dark == nil:
+		res = append(res, Change{Kind: ChangeRemoved, Code: CodeDark})
+	case from.dark != nil && !Equal(from.dark, to.dark):
+		res = append(res, Change{Kind: ChangeModified, Code: CodeDark})
+	}
+
+	sort.Slice(res, func(x, y int) bool {
+		return res[x].Code < res[y].Code
+	})
+	return res
+}
+
+// Equal reports whether two icons hold the same images, unsupported elements and dark
+// icons, as compared by Diff.
+func Equal(x, y *ICNS) bool {
+	return len(Diff(x, y)) == 0
+}
+
+func assetsByCode(i *ICNS) map[uint32]*Img {
+	res := make(map[uint32]*Img, len(i.Assets))
+	for _, a := range i.Assets {
+		if _, ok := res[a.Format.Code]; !ok {
+			res[a.Format.Code] = a
+		}
+	}
+	return res
+}
+
+func chunksByCode(chunks []Chunk) map[uint32][]byte {
+	res := make(map[uint32][]byte, len(chunks))
+	for _, c := range chunks {
+		if _, ok := res[c.Code]; !ok {
+			res[c.Code] = c.Data
+		}
+	}
+	return res
+}
+
+// sameAsset reports whether two images of the same format have the same content.
+func sameAsset(a, b *Img) bool {
+	if a.unmodified() && b.unmodified() {
+		return a.SHA256() == b.SHA256()
+	}
+	x, err := a.AsImage()
+	if err != nil {
+		return false
+	}
+	y, err := b.AsImage()
+	return err == nil && utils.EqualImages(x, y)
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	decode := func() *ICNS {
+		t.Helper()
+		i, err := Decode(testdataFileReader(t, "mit.icns"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return i
+	}
+	from, to := decode(), decode()
+	if !Equal(from, to) {
+		t.Fatalf("decoded icons differ: %v", Diff(from, to))
+	}
+
+	// same pixels, different data
+	a, _ := to.ByCode(CodeIc07)
+	a.Image = utils.CloneImage(a.Image)
+	to.RemoveByCode(CodeIc10)
+	if err := to.AddWithFormat(image.NewNRGBA(image.Rect(0, 0, 16, 16)), CodeIcp4); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := to.ByCode(CodeIc05)
+	b.Image = image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	to.DeriveDark(Desaturate)
+
+	want := []Change{
+		{Kind: ChangeModified, Code: CodeIc05},
+		{Kind: ChangeRemoved, Code: CodeIc10},
+		{Kind: ChangeAdded, Code: CodeIcp4},
+		{Kind: ChangeAdded, Code: CodeDark},
+	}
+	if diff := cmp.Diff(want, Diff(from, to)); diff != "" {
+		t.Errorf("Diff() mismatch (-want +got):\n%s", diff)
+	}
+	if Equal(from, to) {
+		t.Error("Equal reported different icons as equal")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EmbedConfig describes the Go file generated by WriteEmbed.
+type EmbedConfig struct {
+	Package string // package of the Go file
+	Var     string // name of the variable holding the icon, defaults to Icon
+	File    string // name of the .icns file, defaults to icon.icns
+}
+
+// WriteEmbed writes the icon to a .icns file of dir, along with a Go file exposing
+// its content through a go:embed variable, so that programs can include their icon
+// as part of go generate.
+func WriteEmbed(dir string, i *ICNS, c EmbedConfig, opts ...EncodeOption) error {
+	if c.Var == "" {
+		c.Var = "Icon"
+	}
+	if c.File == "" {
+		c.File = "icon.icns"
+	}
+	if !token.IsIdentifier(c.Package) {
+		return fmt.Errorf("invalid package name %q", c.Package)
+	}
+	if !token.IsIdentifier(c.Var) {
+		return fmt.Errorf("invalid variable name %q", c.Var)
+	}
+	if c.File != filepath.Base(c.File) || strings.ContainsAny(c.File, "\"`\n") {
+		return fmt.Errorf("invalid file name %q", c.File)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, opts...); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, c.File), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	src := fmt.Sprintf(`// Code generated by icnsembed. DO NOT EDIT.
+
+package %s
+
+import _ "embed"
+
+// %s is the content of %s.
+//
+//go:embed %s
+var %s []byte
+`, c.Package, c.Var, c.File, c.File, c.Var)
+	code, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(c.File, filepath.Ext(c.File)) + "_icns.go"
+	return os.WriteFile(filepath.Join(dir, name), code, 0o644)
+}
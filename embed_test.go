@@ -0,0 +1,69 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteEmbed(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := WriteEmbed(dir, i, EmbedConfig{Package: "assets", Var: "AppIcon", File: "app.icns"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "app.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Error(err)
+	}
+
+	file := filepath.Join(dir, "app_icns.go")
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name.Name != "assets" || f.Scope.Lookup("AppIcon") == nil {
+		t.Errorf("unexpected generated file: package %s, objects %v", f.Name.Name, f.Scope.Objects)
+	}
+	src, _ := os.ReadFile(file)
+	if !strings.Contains(string(src), "//go:embed app.icns\nvar AppIcon []byte") {
+		t.Errorf("no embed directive in the generated file:\n%s", src)
+	}
+
+	for _, c := range []EmbedConfig{
+		{Package: "not a name"},
+		{Package: "assets", Var: "1icon"},
+		{Package: "assets", File: "../icon.icns"},
+	} {
+		if err := WriteEmbed(dir, i, c); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"sync"
+)
+
+// Encoder writes .icns files, reusing its compression buffers and scratch images
+// from one file to the next. It can be reset to write to another writer with the
+// same options, so that encoders can be pooled.
+//
+// An Encoder is not safe for concurrent use.
+type Encoder struct {
+	w       io.Writer
+	opts    []EncodeOption
+	pngPool pngBufferPool
+	scratch map[uint32]*image.NRGBA
+}
+
+// NewEncoder returns an encoder writing to w.
+func NewEncoder(w io.Writer, opts ...EncodeOption) *Encoder {
+	return &Encoder{
+		w:       w,
+		opts:    opts,
+		scratch: make(map[uint32]*image.NRGBA),
+	}
+}
+
+// Reset makes the encoder write to w, keeping its options and buffers.
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+}
+
+// Encode writes the icon, as Encode does.
+func (e *Encoder) Encode(i *ICNS) error {
+	opts := append(e.opts[:len(e.opts):len(e.opts)], func(o *encodeOptions) {
+		o.pngPool = &e.pngPool
+		o.scratch = e.scratch
+	})
+	return Encode(e.w, i, opts...)
+}
+
+// pngBufferPool shares the buffers of the PNG encoder, possibly across goroutines
+// when images are encoded concurrently.
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	b, _ := p.pool.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) {
+	p.pool.Put(b)
+}
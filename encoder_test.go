@@ -0,0 +1,60 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+	var icons []*ICNS
+	for _, c := range []color.Color{color.White, color.NRGBA{0x80, 0, 0, 0x80}} {
+		src := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+		draw.Draw(src, src.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		i, err := FromImage(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		icons = append(icons, i)
+	}
+
+	opts := []EncodeOption{WithPNGCompression(png.BestSpeed)}
+	e := NewEncoder(nil, opts...)
+	for round := 0; round < 2; round++ {
+		for k, i := range icons {
+			want := new(bytes.Buffer)
+			if err := Encode(want, i, opts...); err != nil {
+				t.Fatal(err)
+			}
+			got := new(bytes.Buffer)
+			e.Reset(got)
+			if err := e.Encode(i); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("round %d, icon %d: output differs from Encode", round, k)
+			}
+		}
+	}
+	if len(opts) != 1 {
+		t.Error("options of the encoder modified")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotSquare is returned when adding an image whose width and height differ.
+	ErrNotSquare = errors.New("image is not a square")
+
+	// ErrNoSuchResolution is returned when looking up an image the icon does not hold.
+	ErrNoSuchResolution = errors.New("no image by that resolution")
+
+	// ErrNoImage is returned by Img.AsImage for an Img built without an image, and
+	// when an icon holds no image at all.
+	ErrNoImage = errors.New("no image set")
+
+	// ErrImageExists is returned by Add when a format already holds an image,
+	// with the ErrorOnExisting policy.
+	ErrImageExists = errors.New("format already holds an image")
+
+	// ErrUnsupportedResolution is returned when no format, within the compatibility
+	// range of the icon, can store an image.
+	ErrUnsupportedResolution = errors.New("no available format")
+)
+
+// UnsupportedChunkError reports an element code that this package does not support.
+type UnsupportedChunkError struct {
+	Code uint32
+}
+
+func (e *UnsupportedChunkError) Error() string {
+	return fmt.Sprintf("unsupported element %s", CodeString(e.Code))
+}
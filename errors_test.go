@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect := image.NewNRGBA(image.Rect(0, 0, 16, 32))
+	empty := rawICNS(t)
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Add", i.Add(rect), ErrNotSquare},
+		{"AddFit", func() error { _, err := i.AddFit(rect); return err }(), ErrNotSquare},
+		{"Add unsupported", i.Add(image.NewNRGBA(image.Rect(0, 0, 20, 20))), ErrUnsupportedResolution},
+		{"ByResolution", func() error { _, err := i.ByResolution(20); return err }(), ErrNoSuchResolution},
+		{"ByPointSize", func() error { _, err := i.ByPointSize(20, 1); return err }(), ErrNoSuchResolution},
+		{"ByCode", func() error { _, err := NewICNS().ByCode(CodeIc07); return err }(), ErrNoSuchResolution},
+		{"HighestResolution", func() error { _, err := NewICNS().HighestResolution(); return err }(), ErrNoImage},
+		{"DecodeConfig", func() error { _, err := DecodeConfig(bytes.NewReader(empty)); return err }(), ErrNoImage},
+		{"DecodeImageAt", func() error { _, err := DecodeImageAt(bytes.NewReader(empty), int64(len(empty)), CodeIc07); return err }(), ErrNoSuchResolution},
+	} {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.err, tc.want)
+		}
+	}
+
+	code, err := CodeFromString("icnV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uerr *UnsupportedChunkError
+	_, err = DecodeImageAt(testdataFileReader(t, "mit.icns"), 0, code)
+	if !errors.As(err, &uerr) || CodeString(uerr.Code) != "icnV" {
+		t.Errorf("got %v, want an UnsupportedChunkError for icnV", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// hicolorSizes are the usual sizes of the freedesktop hicolor icon theme.
+var hicolorSizes = []int{16, 22, 24, 32, 48, 64, 96, 128, 256, 512}
+
+// WriteHicolor writes the icon as PNG files of a freedesktop hicolor icon theme,
+// such as <dir>/hicolor/256x256/apps/<name>.png. Without sizes, the usual sizes of the theme
+// up to the highest resolution of the icon are written. Sizes without image are scaled
+// from the closest larger one.
+func (i *ICNS) WriteHicolor(dir, name string, sizes ...int) error {
+	top, err := i.highestResolutionAsset()
+	if err != nil {
+		return err
+	}
+	if len(sizes) == 0 {
+		for _, s := range hicolorSizes {
+			if s <= int(top.Format.Res) {
+				sizes = append(sizes, s)
+			}
+		}
+	}
+
+	for _, s := range sizes {
+		if s <= 0 {
+			return fmt.Errorf("invalid size %d", s)
+		}
+		data, err := i.sizedPNG(s)
+		if err != nil {
+			return err
+		}
+		d := filepath.Join(dir, "hicolor", fmt.Sprintf("%dx%d", s, s), "apps")
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(d, name+".png"), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sizedPNG returns PNG data of the icon at the provided size, scaling the closest larger image
+// when needed.
+func (i *ICNS) sizedPNG(size int) ([]byte, error) {
+	src, img, err := i.scaleSource(Resolution(size))
+	if err != nil {
+		return nil, err
+	}
+	if src.Format.Res == Resolution(size) {
+		return pngData(src)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, i.resize(img, Resolution(size))); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFavicons writes the usual web icons of the icon to a directory: favicon.ico,
+// favicon-16x16.png, favicon-32x32.png, apple-touch-icon.png (180px) and
+// icon-512-maskable.png, whose image lies within the safe area of maskable icons.
+// The last two are filled with the background color, as their transparency is not kept
+// by the platforms using them.
+func (i *ICNS) WriteFavicons(dir string, background color.Color) error {
+	if len(i.Assets) == 0 {
+		return fmt.Errorf("no image to write")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := i.EncodeICO(buf, 16, 32, 48); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"favicon.ico": buf.Bytes(),
+	}
+
+	for _, s := range []int{16, 32} {
+		data, err := i.sizedPNG(s)
+		if err != nil {
+			return err
+		}
+		files[fmt.Sprintf("favicon-%dx%d.png", s, s)] = data
+	}
+
+	// the safe area of maskable icons is a centered circle of 80% of their size
+	for name, tc := range map[string]struct{ size, content int }{
+		"apple-touch-icon.png":  {180, 180},
+		"icon-512-maskable.png": {512, 410},
+	} {
+		img := image.NewNRGBA(image.Rect(0, 0, tc.size, tc.size))
+		draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+		_, src, err := i.scaleSource(Resolution(tc.content))
+		if err != nil {
+			return err
+		}
+		content := i.resize(src, Resolution(tc.content))
+		off := (tc.size - tc.content) / 2
+		draw.Draw(img, content.Bounds().Add(image.Pt(off, off)), content, content.Bounds().Min, draw.Over)
+
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			return err
+		}
+		files[name] = buf.Bytes()
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
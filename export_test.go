@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteHicolor(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = i.Filter(func(a *Img) bool {
+		return a.Format.Res <= Pixel256
+	})
+
+	dir := t.TempDir()
+	if err := i.WriteHicolor(dir, "mit"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"16x16", "22x22", "24x24", "32x32", "48x48", "64x64", "96x96", "128x128", "256x256"} {
+		data, err := os.ReadFile(filepath.Join(dir, "hicolor", s, "apps", "mit.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%dx%d", cfg.Width, cfg.Height); got != s {
+			t.Errorf("%s: got %s image", s, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hicolor", "512x512")); err == nil {
+		t.Error("upscaled image written")
+	}
+
+	if err := i.WriteHicolor(dir, "mit", 512); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hicolor", "512x512", "apps", "mit.png")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteFavicons(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := i.WriteFavicons(dir, color.White); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range map[string]int{
+		"favicon-16x16.png":     16,
+		"favicon-32x32.png":     32,
+		"apple-touch-icon.png":  180,
+		"icon-512-maskable.png": 512,
+	} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Errorf("%s: got %dx%d image, want %dpx", name, b.Dx(), b.Dy(), size)
+		}
+		if name == "icon-512-maskable.png" && rgba(img.At(0, 0)) != rgba(color.White) {
+			t.Errorf("%s: got %v in the corner, want the background", name, img.At(0, 0))
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, "favicon.ico"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ico, err := FromICO(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range []Resolution{Pixel16, Pixel32, Pixel48} {
+		if _, err := ico.ByResolution(res); err != nil {
+			t.Errorf("favicon.ico: %dpx: %v", res, err)
+		}
+	}
+}
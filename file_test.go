@@ -0,0 +1,77 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeFile(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "icon.icns")
+	if err := i.EncodeFile(path); err != nil {
+		t.Fatal(err)
+	}
+	want := new(bytes.Buffer)
+	if err := Encode(want, i); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Error("unexpected file content")
+	}
+
+	d, err := DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Assets) != len(i.Assets) {
+		t.Errorf("got %d images, want %d", len(d.Assets), len(i.Assets))
+	}
+
+	// a failed encoding leaves the previous file untouched, without leftovers
+	bad := NewICNS()
+	bad.Assets = append(bad.Assets, &Img{
+		Image:    image.NewNRGBA(image.Rect(0, 0, 128, 128)),
+		Format:   supportedImageFormats[CodeIc07],
+		Encoding: EncodingRLE,
+	})
+	if err := bad.EncodeFile(path); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("file modified by a failed encoding: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("unexpected directory content: %v, %v", entries, err)
+	}
+
+	if _, err := DecodeFile(filepath.Join(dir, "missing.icns")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build darwin
+
+package icns
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Extended attributes and Finder flags of custom icons.
+const (
+	finderInfoAttr = "com.apple.FinderInfo"
+	resourceAttr   = "com.apple.ResourceFork"
+	hasCustomIcon  = 0x0400
+	isInvisible    = 0x4000
+)
+
+// SetFolderIcon sets the custom icon of a directory shown by the Finder, writing
+// its custom icon file and setting its custom icon flag.
+func SetFolderIcon(dir string, i *ICNS, opts ...EncodeOption) error {
+	fork, err := CustomIconResourceFork(i, opts...)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, CustomIconFile)
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		return err
+	}
+	if err := unix.Setxattr(file, resourceAttr, fork, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: file, Err: err}
+	}
+
+	// the icon file is an invisible 'icon' file of the Finder ('MACS')
+	info := make([]byte, 32)
+	copy(info, "iconMACS")
+	info[8] = isInvisible >> 8
+	if err := unix.Setxattr(file, finderInfoAttr, info, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: file, Err: err}
+	}
+
+	info = make([]byte, 32)
+	if _, err := unix.Getxattr(dir, finderInfoAttr, info); err != nil && err != unix.ENOATTR {
+		return &os.PathError{Op: "getxattr", Path: dir, Err: err}
+	}
+	info[8] |= hasCustomIcon >> 8
+	if err := unix.Setxattr(dir, finderInfoAttr, info, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: dir, Err: err}
+	}
+	return nil
+}
@@ -15,22 +15,31 @@
 package icns
 
 import (
-	"image"
-	"image/color"
-	"io"
-	"io/ioutil"
+	"bytes"
+	"fmt"
+	"sort"
 
-	"github.com/kroksys/icns/internal/codec"
+	"github.com/kroksys/icns/codec"
 )
 
+// Format describes a single icon type stored in an ICNS file.
+//
+// Res is the size of the image in pixels, while PointSize and Scale describe
+// the same image in terms of the logical size it is displayed at: ic11 is a
+// 16pt@2x image and icp5 is a 32pt@1x image, although both are 32 pixels wide.
 type Format struct {
 	Code        uint32
 	CombineCode uint32
 	Res         Resolution
+	PointSize   uint
+	Scale       uint
 	Compat      Compatibility
 	Codec       codec.Codec
 }
 
+// Codec reads and writes the data of a single icon type.
+type Codec = codec.Codec
+
 var (
 	supportedImageFormats map[uint32]*Format
 	supportedMaskFormats  map[uint32]*Format
@@ -41,14 +50,15 @@ func init() {
 	supportedMaskFormats = make(map[uint32]*Format)
 
 	legacyFormats := []struct {
-		code uint32
-		mask uint32
-		res  Resolution
+		code  uint32
+		mask  uint32
+		res   Resolution
+		codec codec.Codec
 	}{
-		{is32, s8mk, Pixel16},
-		{il32, l8mk, Pixel32},
-		{ih32, h8mk, Pixel16},
-		{it32, t8mk, Pixel32},
+		{CodeIs32, CodeS8mk, Pixel16, codec.PackCodec},
+		{CodeIl32, CodeL8mk, Pixel32, codec.PackCodec},
+		{CodeIh32, CodeH8mk, Pixel48, codec.PackCodec},
+		{CodeIt32, CodeT8mk, Pixel128, codec.It32Codec},
 	}
 
 	for _, f := range legacyFormats {
@@ -56,14 +66,18 @@ func init() {
 			Code:        f.code,
 			CombineCode: f.mask,
 			Res:         f.res,
+			PointSize:   uint(f.res),
+			Scale:       1,
 			Compat:      Allegro,
-			Codec:       codec.PackCodec,
+			Codec:       f.codec,
 		}
 
 		supportedMaskFormats[f.mask] = &Format{
 			Code:        f.mask,
 			CombineCode: f.code,
 			Res:         f.res,
+			PointSize:   uint(f.res),
+			Scale:       1,
 			Compat:      Allegro,
 			Codec:       codec.MaskCodec,
 		}
@@ -73,72 +87,266 @@ func init() {
 		code uint32
 		res  Resolution
 	}{
-		{ic04, Pixel16},
-		{ic05, Pixel32},
+		{CodeIc04, Pixel16},
+		{CodeIc05, Pixel32},
 	}
 
 	for _, f := range argbFormats {
 		supportedImageFormats[f.code] = &Format{
-			Code:   f.code,
-			Res:    f.res,
-			Compat: Cheetah, // not quite sure
-			Codec:  codec.ARGBCodec,
+			Code:      f.code,
+			Res:       f.res,
+			PointSize: uint(f.res),
+			Scale:     1,
+			Compat:    Cheetah, // not quite sure
+			Codec:     codec.ARGBCodec,
 		}
 	}
 
 	modernFormats := []struct {
 		code   uint32
 		res    Resolution
+		scale  uint
 		compat Compatibility
 	}{
-		{icp4, Pixel16, Lion},
-		{icp5, Pixel32, Lion},
-		{icp6, Pixel64, Lion},
-		{ic07, Pixel128, Lion},
-		{ic08, Pixel256, Leopard},
-		{ic09, Pixel512, Leopard},
-		{ic10, Pixel1024, Lion},
-		{ic11, Pixel32, MountainLion},
-		{ic12, Pixel64, MountainLion},
-		{ic13, Pixel256, MountainLion},
-		{ic14, Pixel512, MountainLion},
+		{CodeIcp4, Pixel16, 1, Lion},
+		{CodeIcp5, Pixel32, 1, Lion},
+		{CodeIcp6, Pixel64, 1, Lion},
+		{CodeIc07, Pixel128, 1, Lion},
+		{CodeIc08, Pixel256, 1, Leopard},
+		{CodeIc09, Pixel512, 1, Leopard},
+		{CodeIc10, Pixel1024, 2, Lion},
+		{CodeIc11, Pixel32, 2, MountainLion},
+		{CodeIc12, Pixel64, 2, MountainLion},
+		{CodeIc13, Pixel256, 2, MountainLion},
+		{CodeIc14, Pixel512, 2, MountainLion},
 	}
 
 	for _, f := range modernFormats {
 		supportedImageFormats[f.code] = &Format{
-			Code:   f.code,
-			Res:    f.res,
-			Compat: f.compat,
-			Codec:  codec.ImageCodec,
+			Code:      f.code,
+			Res:       f.res,
+			PointSize: uint(f.res) / f.scale,
+			Scale:     f.scale,
+			Compat:    f.compat,
+			Codec:     codec.ImageCodec,
 		}
 	}
+}
+
+// RegisterFormat teaches the package about an additional icon type, such as a
+// vendor-specific or newly introduced one. Images stored under code are then
+// decoded and encoded with c, and Add considers the format for images of the
+// given resolution.
+//
+// Registering an already known code replaces its resolution, compatibility and codec.
+// RegisterFormat is not safe for concurrent use with other functions of this package,
+// and is meant to be called from an init function.
+func RegisterFormat(code uint32, res Resolution, compat Compatibility, c Codec) {
+	if c == nil {
+		panic("icns: RegisterFormat called with a nil codec")
+	}
+	if _, ok := supportedMaskFormats[code]; ok {
+		panic("icns: RegisterFormat called with a mask code " + CodeString(code))
+	}
 
-	// register into image decoding library. Use the highest available resolution for that purpose.
-	image.RegisterFormat("icns", codeRepr(magic),
-		func(r io.Reader) (image.Image, error) {
-			i, err := Decode(r)
-			if err != nil {
-				return nil, err
-			}
-			return i.HighestResolution()
-		},
-		func(r io.Reader) (image.Config, error) {
-			bytes, err := ioutil.ReadAll(r)
-			if err != nil {
-				return image.Config{}, err
-			}
-			i, err := readICNS(bytes, true)
-			if err != nil {
-				return image.Config{}, err
-			}
-			img, err := i.highestResolutionAsset()
-			if err != nil {
-				return image.Config{}, err
-			}
-			return image.Config{
-				ColorModel: color.NRGBAModel,
-				Width:      int(img.Format.Res),
-				Height:     int(img.Format.Res),
-			}, nil
-		})
+	f := &Format{
+		Code:      code,
+		Res:       res,
+		PointSize: uint(res),
+		Scale:     1,
+		Compat:    compat,
+		Codec:     c,
+	}
+	if old, ok := supportedImageFormats[code]; ok {
+		f.CombineCode = old.CombineCode
+		if old.Res == res {
+			f.PointSize = old.PointSize
+			f.Scale = old.Scale
+		}
+	}
+	supportedImageFormats[code] = f
 }
+
+// SupportedFormats returns the image formats compatible with the provided range of
+// OS versions, ordered by resolution, then by code. Masks are not included.
+func SupportedFormats(min, max Compatibility) []*Format {
+	var res []*Format
+	for _, f := range supportedImageFormats {
+		if f.Compat >= min && f.Compat <= max {
+			res = append(res, f)
+		}
+	}
+	sort.Slice(res, func(x, y int) bool {
+		if res[x].Res != res[y].Res {
+			return res[x].Res < res[y].Res
+		}
+		return res[x].Code < res[y].Code
+	})
+	return res
+}
+
+// FormatByCode returns the format of the image or mask stored under code, and whether
+// the code is supported. The CombineCode of legacy images is the code of their mask,
+// and the other way around.
+func FormatByCode(code uint32) (*Format, bool) {
+	if f, ok := supportedImageFormats[code]; ok {
+		return f, true
+	}
+	f, ok := supportedMaskFormats[code]
+	return f, ok
+}
+
+// FormatsByResolution returns the image formats of the provided resolution, whatever
+// their compatibility, ordered by code.
+func FormatsByResolution(r Resolution) []*Format {
+	var res []*Format
+	for _, f := range supportedImageFormats {
+		if f.Res == r {
+			res = append(res, f)
+		}
+	}
+	sort.Slice(res, func(x, y int) bool {
+		return res[x].Code < res[y].Code
+	})
+	return res
+}
+
+// SupportedResolutions returns, in increasing order, the resolutions of the image
+// formats compatible with the provided range of OS versions.
+func SupportedResolutions(min, max Compatibility) []Resolution {
+	var res []Resolution
+	for _, f := range SupportedFormats(min, max) {
+		if len(res) == 0 || res[len(res)-1] != f.Res {
+			res = append(res, f.Res)
+		}
+	}
+	return res
+}
+
+// legacy reports whether the format predates the PNG and JPEG based ones.
+func (f *Format) legacy() bool {
+	return f.CombineCode != 0 || f.Codec == codec.ARGBCodec
+}
+
+// Encoding selects how the data of an image is stored.
+type Encoding uint8
+
+const (
+	// EncodingAuto uses the default storage of the format.
+	EncodingAuto Encoding = iota
+	// EncodingPNG stores PNG data.
+	EncodingPNG
+	// EncodingJPEG stores JPEG data, which has no alpha channel.
+	EncodingJPEG
+	// EncodingARGB stores RLE-packed ARGB channels.
+	EncodingARGB
+	// EncodingRLE stores RLE-packed RGB channels, with a separate 8-bit mask.
+	EncodingRLE
+	// EncodingJP2 is JPEG 2000 data, found in files written by old versions of macOS.
+	// It is only reported by Img.DataEncoding, as this package cannot decode nor encode it.
+	EncodingJP2
+)
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingAuto:
+		return "auto"
+	case EncodingPNG:
+		return "png"
+	case EncodingJPEG:
+		return "jpeg"
+	case EncodingARGB:
+		return "argb"
+	case EncodingRLE:
+		return "rle"
+	case EncodingJP2:
+		return "jp2"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name returned by String.
+func (e Encoding) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// defaultEncoding returns the encoding used by Encode for images of the format
+// stored with EncodingAuto.
+func (f *Format) defaultEncoding() Encoding {
+	switch f.Codec {
+	case codec.ImageCodec:
+		return EncodingPNG
+	case codec.JPEGCodec:
+		return EncodingJPEG
+	case codec.ARGBCodec:
+		return EncodingARGB
+	case codec.PackCodec, codec.It32Codec:
+		return EncodingRLE
+	}
+	return EncodingAuto
+}
+
+// codecFor returns the codec storing images of the format with the provided encoding.
+func (f *Format) codecFor(e Encoding) (codec.Codec, error) {
+	if e == EncodingAuto {
+		return f.Codec, nil
+	}
+
+	var codecs map[Encoding]codec.Codec
+	switch f.Codec {
+	case codec.PackCodec, codec.It32Codec:
+		codecs = map[Encoding]codec.Codec{
+			EncodingRLE: f.Codec,
+		}
+	case codec.ARGBCodec:
+		codecs = map[Encoding]codec.Codec{
+			EncodingARGB: codec.ARGBCodec,
+			EncodingPNG:  codec.ImageCodec,
+			EncodingJPEG: codec.JPEGCodec,
+		}
+	case codec.ImageCodec:
+		codecs = map[Encoding]codec.Codec{
+			EncodingPNG:  codec.ImageCodec,
+			EncodingJPEG: codec.JPEGCodec,
+		}
+	}
+
+	if c, ok := codecs[e]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%s images cannot be stored as %s", CodeString(f.Code), e)
+}
+
+// decoderFor returns the codec decoding data stored under the format,
+// which may use another encoding than the default one.
+func (f *Format) decoderFor(data []byte) codec.Codec {
+	if f.Codec == codec.ARGBCodec && (bytes.HasPrefix(data, pngHeader) || bytes.HasPrefix(data, jpegHeader)) {
+		return codec.ImageCodec
+	}
+	return f.Codec
+}
+
+// dataEncoding returns the encoding of data, decoded by a codec reporting enc.
+func dataEncoding(enc string, data []byte) Encoding {
+	if bytes.HasPrefix(data, jp2Header) || bytes.HasPrefix(data, j2kHeader) {
+		return EncodingJP2
+	}
+	switch enc {
+	case "png":
+		return EncodingPNG
+	case "jpeg":
+		return EncodingJPEG
+	case "argb":
+		return EncodingARGB
+	case "icon":
+		return EncodingRLE
+	}
+	return EncodingAuto
+}
+
+var (
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+	jpegHeader = []byte{0xff, 0xd8}
+	jp2Header  = []byte("\x00\x00\x00\x0cjP  \r\n\x87\n")
+	j2kHeader  = []byte{0xff, 0x4f, 0xff, 0x51}
+)
@@ -16,11 +16,16 @@ package icns
 
 import (
 	"bytes"
+	"errors"
 	"image"
+	"image/color"
+	"image/draw"
 	"io"
 	"io/ioutil"
 	"path"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 type test interface {
@@ -39,36 +44,40 @@ func testdataFileReader(t test, fname string) *bytes.Reader {
 	return bytes.NewReader(body)
 }
 
-func TestDecode(t *testing.T) {
+func TestDecodeConfig(t *testing.T) {
 	t.Parallel()
-	img, fmt, err := image.Decode(testdataFileReader(t, "mit.icns"))
+	cfg, err := DecodeConfig(testdataFileReader(t, "mit.icns"))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if fmt != "icns" {
-		t.Errorf("unexpected image format: got %s, want icns", fmt)
+	if cfg.Width != 1024 || cfg.Height != 1024 {
+		t.Errorf("unexpected image size: got %dx%d, want 1024x1024", cfg.Width, cfg.Height)
 	}
 
-	bounds := img.Bounds()
-	if bounds.Dx() != 1024 || bounds.Dy() != 1024 {
-		t.Errorf("unexpected image size: got %dx%d, want 1024x1024", bounds.Dx(), bounds.Dy())
+	// only the element headers are read
+	b := rawICNS(t, Chunk{Code: CodeIc07, Data: []byte("not decoded")}, Chunk{Code: CodeIcp4, Data: nil})
+	cfg, err = DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 128 || cfg.Height != 128 {
+		t.Errorf("unexpected image size: got %dx%d, want 128x128", cfg.Width, cfg.Height)
+	}
+	if _, err := DecodeConfig(bytes.NewReader(b[:len(b)-4])); err == nil {
+		t.Error("expected an error for a truncated file")
 	}
 }
 
-func TestDecodeConfig(t *testing.T) {
+func TestResolutions(t *testing.T) {
 	t.Parallel()
-	cfg, fmt, err := image.DecodeConfig(testdataFileReader(t, "mit.icns"))
+	got, err := Resolutions(testdataFileReader(t, "mit.icns"))
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if fmt != "icns" {
-		t.Errorf("unexpected image format: got %s, want icns", fmt)
-	}
-
-	if cfg.Width != 1024 || cfg.Height != 1024 {
-		t.Errorf("unexpected image size: got %dx%d, want 1024x1024", cfg.Width, cfg.Height)
+	want := []Resolution{Pixel16, Pixel32, Pixel64, Pixel128, Pixel256, Pixel512, Pixel1024}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected resolutions (-want +got):\n%s", diff)
 	}
 }
 
@@ -81,8 +90,163 @@ func BenchmarkDecodeConfig(b *testing.B) {
 		if _, err := r.Seek(0, io.SeekStart); err != nil {
 			b.Fatal(err)
 		}
-		if _, _, err := image.DecodeConfig(r); err != nil {
+		if _, err := DecodeConfig(r); err != nil {
 			b.Fatal(err)
 		}
 	}
 }
+
+// grayCodec stores an image as a single gray level, which is enough to
+// exercise custom formats.
+type grayCodec struct{}
+
+func (grayCodec) Encode(w io.Writer, img image.Image) error {
+	g := color.GrayModel.Convert(img.At(0, 0)).(color.Gray)
+	_, err := w.Write([]byte{g.Y})
+	return err
+}
+
+func (grayCodec) Decode(r io.Reader, res Resolution) (image.Image, string, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) != 1 {
+		return nil, "", errors.New("unexpected gray data")
+	}
+	img := image.NewGray(image.Rect(0, 0, int(res), int(res)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: body[0]}), image.Point{}, draw.Src)
+	return img, "gray", nil
+}
+
+func TestSupportedFormats(t *testing.T) {
+	t.Parallel()
+	var got []string
+	for _, f := range SupportedFormats(Lion, Lion) {
+		got = append(got, CodeString(f.Code))
+	}
+	want := []string{"icp4", "icp5", "icp6", "ic07", "ic10"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SupportedFormats(Lion, Lion) mismatch (-want +got):\n%s", diff)
+	}
+
+	wantRes := []Resolution{Pixel16, Pixel32, Pixel48, Pixel128}
+	if diff := cmp.Diff(wantRes, SupportedResolutions(Oldest, Allegro)); diff != "" {
+		t.Errorf("SupportedResolutions(Oldest, Allegro) mismatch (-want +got):\n%s", diff)
+	}
+	if got := SupportedResolutions(Lion, Cheetah); len(got) != 0 {
+		t.Errorf("got resolutions %v for an empty range", got)
+	}
+}
+
+func TestFormatByCode(t *testing.T) {
+	t.Parallel()
+	f, ok := FormatByCode(CodeIl32)
+	if !ok || f.Res != Pixel32 || f.CombineCode != CodeL8mk {
+		t.Errorf("FormatByCode(il32) = %+v, %v", f, ok)
+	}
+	if m, ok := FormatByCode(f.CombineCode); !ok || m.CombineCode != CodeIl32 || m.Res != Pixel32 {
+		t.Errorf("FormatByCode(l8mk) = %+v, %v", m, ok)
+	}
+	if _, ok := FormatByCode(0); ok {
+		t.Error("FormatByCode(0) reported a supported code")
+	}
+
+	var got []string
+	for _, f := range FormatsByResolution(Pixel32) {
+		got = append(got, CodeString(f.Code))
+	}
+	if diff := cmp.Diff([]string{"ic05", "ic11", "icp5", "il32"}, got); diff != "" {
+		t.Errorf("FormatsByResolution(32) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	const code uint32 = 'x'<<24 | 'g'<<16 | 'r'<<8 | 'y'
+	RegisterFormat(code, Pixel48, Lion, grayCodec{})
+	t.Cleanup(func() {
+		delete(supportedImageFormats, code)
+	})
+
+	i := NewICNS(WithMinCompatibility(Lion))
+	src := image.NewGray(image.Rect(0, 0, 48, 48))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.Gray{Y: 0x42}), image.Point{}, draw.Src)
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Assets) != 1 || dec.Assets[0].Format.Code != code {
+		t.Fatalf("unexpected assets after round trip:\n%s", dec.Info())
+	}
+	if got := dec.Assets[0].Image.At(10, 10).(color.Gray); got.Y != 0x42 {
+		t.Errorf("unexpected pixel: got %#x, want 0x42", got.Y)
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	t.Parallel()
+	if got := CodeString(CodeIc07); got != "ic07" {
+		t.Errorf("CodeString(CodeIc07): got %q, want ic07", got)
+	}
+
+	c, err := CodeFromString("il32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != CodeIl32 {
+		t.Errorf("CodeFromString(il32): got %#x, want %#x", c, CodeIl32)
+	}
+
+	for _, s := range []string{"", "ic0", "ic077"} {
+		if _, err := CodeFromString(s); err == nil {
+			t.Errorf("CodeFromString(%q): expected an error", s)
+		}
+	}
+}
+
+func TestLegacyFormatSizes(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		code uint32
+		want Resolution
+	}{
+		{CodeIh32, Pixel48},
+		{CodeIt32, Pixel128},
+	}
+
+	for _, tt := range data {
+		f := supportedImageFormats[tt.code]
+		if f.Res != tt.want {
+			t.Errorf("%08x: got %dpx, want %dpx", tt.code, f.Res, tt.want)
+			continue
+		}
+
+		src := image.NewNRGBA(image.Rect(0, 0, int(tt.want), int(tt.want)))
+		for i := range src.Pix {
+			src.Pix[i] = uint8(i)
+			if i%4 == 3 {
+				src.Pix[i] = 0xff
+			}
+		}
+		buf := new(bytes.Buffer)
+		if err := f.Codec.Encode(buf, src); err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := f.Codec.Decode(buf, f.Res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := img.At(7, 3), src.At(7, 3); got != want {
+			t.Errorf("%08x: got %v at (7, 3), want %v", tt.code, got, want)
+		}
+	}
+}
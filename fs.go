@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// FS returns a read-only file system exposing the images of the icon as the PNG files
+// of an .iconset directory, such as icon_32x32@2x.png. The images are encoded when opened.
+func FS(i *ICNS) fs.FS {
+	return iconFS{i}
+}
+
+type iconFS struct {
+	i *ICNS
+}
+
+// files returns the names of the available files, and the images they hold.
+func (f iconFS) files() ([]string, map[string]*Img) {
+	var names []string
+	images := make(map[string]*Img)
+	for _, file := range iconsetFiles {
+		if a := f.i.iconsetImage(supportedImageFormats[file.code]); a != nil {
+			names = append(names, file.name)
+			images[file.name] = a
+		}
+	}
+	return names, images
+}
+
+func (f iconFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	names, images := f.files()
+	if name == "." {
+		d := &dirFile{}
+		for _, n := range names {
+			d.entries = append(d.entries, dirEntry{name: n, img: images[n]})
+		}
+		return d, nil
+	}
+
+	a, ok := images[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := pngData(a)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(data), info: fileInfo{name: name, size: int64(len(data))}}, nil
+}
+
+// dirEntry describes a file of the icon, whose image is encoded to know its size.
+type dirEntry struct {
+	name string
+	img  *Img
+}
+
+func (e dirEntry) Name() string      { return e.name }
+func (e dirEntry) IsDir() bool       { return false }
+func (e dirEntry) Type() fs.FileMode { return 0 }
+
+func (e dirEntry) Info() (fs.FileInfo, error) {
+	data, err := pngData(e.img)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: e.name, Err: err}
+	}
+	return fileInfo{name: e.name, size: int64(len(data))}, nil
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+func (fi fileInfo) Size() int64  { return fi.size }
+func (fi fileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+func (fi fileInfo) IsDir() bool { return fi.dir }
+func (fi fileInfo) Sys() any    { return nil }
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+type dirFile struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return fileInfo{name: ".", dir: true}, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.offset += len(rest)
+	return rest, nil
+}
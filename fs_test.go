@@ -0,0 +1,46 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.RemoveByCode(CodeIc10)
+
+	fsys := FS(i)
+	var names []string
+	for _, file := range iconsetFiles[:len(iconsetFiles)-1] {
+		names = append(names, file.name)
+	}
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+
+	back, err := FromIconset(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Assets) != len(i.Assets) {
+		t.Errorf("unexpected icon read from the file system:\n%s", back.Info())
+	}
+}
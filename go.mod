@@ -1,5 +1,9 @@
 module github.com/kroksys/icns
 
-go 1.15
+go 1.23
 
-require github.com/google/go-cmp v0.5.5
+require (
+	github.com/google/go-cmp v0.5.5
+	golang.org/x/image v0.23.0
+	golang.org/x/sys v0.28.0
+)
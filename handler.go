@@ -0,0 +1,141 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxHandlerSize bounds the sizes served by Handler.
+const maxHandlerSize = 1024
+
+// Handler returns an HTTP handler serving the icon as PNG images, at the size requested
+// either with a size parameter (/icon?size=128) or by the requested file name (/icon-128.png).
+// The closest image of the icon is used, scaled when needed. Images at the resolutions of the
+// icon are cached by the handler, so the icon must not be modified while being served; other
+// sizes are scaled for each request.
+func Handler(i *ICNS) http.Handler {
+	return &handler{i: i, cache: make(map[int]*cachedImage)}
+}
+
+type handler struct {
+	i     *ICNS
+	mu    sync.Mutex // guards cache, but not the rendering of the images
+	cache map[int]*cachedImage
+}
+
+type cachedImage struct {
+	once sync.Once
+	img  *servedImage
+	err  error
+}
+
+type servedImage struct {
+	data []byte
+	etag string
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size, err := requestedSize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	img, err := h.image(size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", img.etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img.data))
+}
+
+// requestedSize returns the size requested by the size parameter or the file name.
+func requestedSize(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("size")
+	if s == "" {
+		var n int
+		if _, err := fmt.Sscanf(path.Base(r.URL.Path), "icon-%d.png", &n); err != nil {
+			return 0, fmt.Errorf("no size requested")
+		}
+		s = strconv.Itoa(n)
+	}
+	size, err := strconv.Atoi(s)
+	if err != nil || size <= 0 || size > maxHandlerSize {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size, nil
+}
+
+// image returns the image served at size, cached when size is one of the resolutions
+// of the icon, which bounds the size of the cache.
+func (h *handler) image(size int) (*servedImage, error) {
+	if !h.native(size) {
+		return h.render(size)
+	}
+
+	h.mu.Lock()
+	c, ok := h.cache[size]
+	if !ok {
+		c = &cachedImage{}
+		h.cache[size] = c
+	}
+	h.mu.Unlock()
+
+	c.once.Do(func() {
+		c.img, c.err = h.render(size)
+	})
+	return c.img, c.err
+}
+
+// native reports whether the icon has an image of the given size.
+func (h *handler) native(size int) bool {
+	for _, a := range h.i.Assets {
+		if int(a.Format.Res) == size {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *handler) render(size int) (*servedImage, error) {
+	if len(h.i.Assets) == 0 {
+		return nil, fmt.Errorf("no image available")
+	}
+	data, err := h.i.sizedPNG(size)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &servedImage{data: data, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}, nil
+}
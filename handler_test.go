@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(i)
+
+	for _, tc := range []struct {
+		target string
+		status int
+		size   int
+	}{
+		{"/icon?size=128", http.StatusOK, 128},
+		{"/icons/icon-48.png", http.StatusOK, 48},
+		{"/icon?size=1024", http.StatusOK, 1024},
+		{"/icon", http.StatusBadRequest, 0},
+		{"/icon?size=0", http.StatusBadRequest, 0},
+		{"/icon?size=4096", http.StatusBadRequest, 0},
+		{"/icon-big.png", http.StatusBadRequest, 0},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.target, rec.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+			t.Errorf("%s: got content type %q", tc.target, ct)
+		}
+		cfg, err := png.DecodeConfig(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.target, err)
+		}
+		if cfg.Width != tc.size || cfg.Height != tc.size {
+			t.Errorf("%s: got %dx%d image, want %dpx", tc.target, cfg.Width, cfg.Height, tc.size)
+		}
+
+		etag := rec.Header().Get("ETag")
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("%s: got status %d for a cached image, want %d", tc.target, rec.Code, http.StatusNotModified)
+		}
+	}
+
+	for size := range h.(*handler).cache {
+		if size != 128 && size != 1024 {
+			t.Errorf("unexpected cached size %d", size)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/icon?size=16", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
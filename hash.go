@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"crypto/sha256"
+	"math/bits"
+)
+
+// SHA256 returns the SHA-256 digest of Data, identifying the payload read from the
+// source file. Data is not updated when the image is replaced or modified; see ReEncode.
+func (a *Img) SHA256() [sha256.Size]byte {
+	return sha256.Sum256(a.Data)
+}
+
+// PHash returns a perceptual hash of the image: a difference hash of its brightness,
+// which changes little when the image is resized or re-compressed, unlike SHA256.
+// Compare hashes with PHashDistance.
+func (a *Img) PHash() (uint64, error) {
+	img, err := a.AsImage()
+	if err != nil {
+		return 0, err
+	}
+
+	// average the brightness of a 9x8 grid, weighted by the alpha channel
+	// so that transparent pixels count as black
+	const w, h = 9, 8
+	var grid [h][w]uint64
+	var count [h][w]uint64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		gy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gx := (x - b.Min.X) * w / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA() // premultiplied by alpha
+			grid[gy][gx] += (299*uint64(r) + 587*uint64(g) + 114*uint64(bl)) / 1000
+			count[gy][gx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			// compare the averages without dividing: l/cl < r/cr
+			if grid[y][x]*count[y][x+1] < grid[y][x+1]*count[y][x] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// PHashDistance returns the number of differing bits of two perceptual hashes, from 0
+// for images that look the same to 64. Distances up to about 10 denote similar images.
+func PHashDistance(x, y uint64) int {
+	return bits.OnesCount64(x ^ y)
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, _ := i.ByCode(CodeIc09)
+	twin, _ := i.ByCode(CodeIc14)
+	small, _ := i.ByCode(CodeIc05)
+
+	if large.SHA256() != twin.SHA256() || large.SHA256() == small.SHA256() {
+		t.Error("SHA256 does not identify the payloads")
+	}
+
+	hash := func(a *Img) uint64 {
+		t.Helper()
+		h, err := a.PHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	ref := hash(large)
+	if d := PHashDistance(ref, hash(small)); d > 10 {
+		t.Errorf("got distance %d between the 512px and 32px images", d)
+	}
+
+	// the same artwork, flipped horizontally
+	src := large.Image
+	b := src.Bounds()
+	flipped := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			flipped.Set(b.Max.X-1-x, y, src.At(x, y))
+		}
+	}
+	other := &Img{Image: flipped, Format: large.Format}
+	if d := PHashDistance(ref, hash(other)); d <= 10 {
+		t.Errorf("got distance %d between an image and its mirror", d)
+	}
+
+	if _, err := (&Img{Format: large.Format}).PHash(); err == nil {
+		t.Error("expected an error without image")
+	}
+}
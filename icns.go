@@ -20,20 +20,143 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+
+	"github.com/kroksys/icns/internal/utils"
 )
 
+// Img is an image of an icon, stored under Format. The embedded image is set for
+// every image returned by the decoding functions, possibly to a lazily decoded one;
+// AsImage additionally reports decoding errors, and images built without one.
 type Img struct {
 	image.Image
-	Format  *Format
+	Format *Format
+
+	// Encoder is the name of the encoding of Data, such as "png" or "icon".
+	//
+	// Deprecated: use DataEncoding, which is typed.
 	Encoder string
-	Data    []byte
+
+	// Data is the payload read from the source file. It is written back as is by Encode
+	// as long as Image is not replaced nor marked modified, to avoid re-compressing the image.
+	// It shares memory with the decoded file and must not be modified.
+	Data []byte
+
+	// Encoding selects how the image is stored by Encode.
+	// Only some encodings are available for each format.
+	Encoding Encoding
+
+	mask   image.Image // decoded mask of legacy images
+	src    image.Image // decoded image, to detect replacements
+	stored Encoding    // encoding of Data
+	dirty  bool        // Image was modified in place
+}
+
+// DataEncoding returns the encoding of Data, or EncodingAuto if the image was not read
+// from a file. Unlike Encoding, it is set when decoding and describes the source file.
+func (a *Img) DataEncoding() Encoding {
+	return a.stored
+}
+
+// DataSize returns the size in bytes of Data, excluding the element header.
+func (a *Img) DataSize() int {
+	return len(a.Data)
+}
+
+// MaskCode returns the code of the element storing the mask of the image,
+// or 0 when the format stores the alpha channel along with the image.
+func (a *Img) MaskCode() uint32 {
+	return a.Format.CombineCode
+}
+
+// Mask returns the mask of a legacy image, as read from the source file, or nil.
+func (a *Img) Mask() image.Image {
+	return a.mask
+}
+
+// HasAlpha reports whether the image has any pixel that is not fully opaque,
+// decoding it first if needed. It returns false when the image cannot be decoded.
+// The color model is available from the embedded image.
+func (a *Img) HasAlpha() bool {
+	img, err := a.AsImage()
+	return err == nil && !opaque(img)
+}
+
+// unmodified reports whether the image is still the one decoded from Data.
+func (a *Img) unmodified() bool {
+	return a.Data != nil && a.src != nil && a.Image == a.src && !a.dirty
+}
+
+// decodedMask returns the mask of a legacy image read from the source file, as long as
+// the image was neither replaced nor modified since, or nil.
+func (a *Img) decodedMask() image.Image {
+	if a.src == nil || a.Image != a.src || a.dirty {
+		return nil
+	}
+	return a.mask
+}
+
+// MarkModified records that the image was modified in place, such as by drawing onto it,
+// so that Encode compresses it again instead of writing Data back. As when replacing
+// the image, the mask of legacy images is then derived from the image.
+func (a *Img) MarkModified() {
+	a.dirty = true
+	a.mask = nil
+}
+
+// ReEncode compresses the image with the codec selected by Encoding, tuned by the options,
+// and stores the result in Data, which Encode then writes as is. It allows checking the
+// encoded data of images that were replaced or marked modified.
+func (a *Img) ReEncode(opts ...EncodeOption) error {
+	var o encodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	img, err := a.AsImage()
+	if err != nil {
+		return err
+	}
+	c, err := a.Format.codecFor(a.Encoding)
+	if err != nil {
+		return err
+	}
+	src := img
+	if a.Format.CombineCode != 0 {
+		// the encoders expect an NRGBA instance
+		img = utils.Img2NRGBA(img)
+	}
+	buf := new(bytes.Buffer)
+	if err := o.tune(c).Encode(buf, img); err != nil {
+		return err
+	}
+
+	a.mask = a.decodedMask() // a replaced image no longer matches the decoded mask
+	a.Image = src
+	a.src = src
+	a.Data = buf.Bytes()
+	a.Encoder = sniffEncoder(a.Format, a.Data)
+	a.stored = dataEncoding(a.Encoder, a.Data)
+	a.dirty = false
+	return nil
 }
 
 // ICNS encapsulates the Apple Icon Image format specification.
 type ICNS struct {
 	minCompat, maxCompat Compatibility
 	Assets               []*Img
-	unsupportedCodes     []uint32
+	chunks               []Chunk // as read from the source file
+	unsupported          []Chunk
+	extra                []Chunk // added through AddRawChunk
+	scaler               Scaler
+	linear               bool // scale in linear light
+	pad                  bool // center images that are not square
+	dark                 *ICNS
+}
+
+// Chunk is the raw content of an ICNS element, excluding its header.
+type Chunk struct {
+	Code uint32
+	Data []byte
 }
 
 // Option is the type for ICNS creation options.
@@ -67,6 +190,13 @@ func NewICNS(opts ...Option) *ICNS {
 	return i
 }
 
+// Compatibility returns the range of OS versions targeted by the icon. For a decoded icon,
+// this is inferred from the formats present in the file, and min is greater than max
+// when the file contains no supported format.
+func (i *ICNS) Compatibility() (min, max Compatibility) {
+	return i.minCompat, i.maxCompat
+}
+
 // Finds and returns image that is closest to requested resolution.
 func (i *ICNS) ClosestResolution(r Resolution) (*Img, error) {
 	var res Resolution
@@ -95,10 +225,56 @@ func (i *ICNS) ClosestResolution(r Resolution) (*Img, error) {
 func (i *ICNS) ByResolution(r Resolution) (image.Image, error) {
 	for _, a := range i.Assets {
 		if a.Format.Res == r {
-			return a.Image, nil
+			return a.AsImage()
+		}
+	}
+	return nil, ErrNoSuchResolution
+}
+
+// ByCode returns the asset stored under the provided code.
+func (i *ICNS) ByCode(code uint32) (*Img, error) {
+	for _, a := range i.Assets {
+		if a.Format.Code == code {
+			return a, nil
 		}
 	}
-	return nil, fmt.Errorf("no image by that resolution")
+	return nil, fmt.Errorf("no %s image: %w", CodeString(code), ErrNoSuchResolution)
+}
+
+// MissingFor returns the image formats compatible with the provided range of OS versions
+// that the icon holds no image for, ordered as by SupportedFormats. For instance,
+// MissingFor(Lion, Newest) lists the sizes an icon lacks on recent systems.
+func (i *ICNS) MissingFor(min, max Compatibility) []*Format {
+	var res []*Format
+	for _, f := range SupportedFormats(min, max) {
+		if a, _ := i.ByCode(f.Code); a == nil {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// MaskByResolution extracts the 8-bit mask of the legacy image at the provided resolution,
+// as read from the source file.
+func (i *ICNS) MaskByResolution(r Resolution) (image.Image, error) {
+	for _, a := range i.Assets {
+		if a.Format.Res == r && a.mask != nil {
+			return a.mask, nil
+		}
+	}
+	return nil, fmt.Errorf("no mask: %w", ErrNoSuchResolution)
+}
+
+// ByPointSize extracts an image from the icon, at the provided point size and scale.
+// Unlike ByResolution, it tells apart formats sharing a pixel size, such as ic11 (16pt@2x)
+// and icp5 (32pt@1x).
+func (i *ICNS) ByPointSize(pt, scale uint) (image.Image, error) {
+	for _, a := range i.Assets {
+		if a.Format.PointSize == pt && a.Format.Scale == scale {
+			return a.AsImage()
+		}
+	}
+	return nil, fmt.Errorf("%dpt@%dx: %w", pt, scale, ErrNoSuchResolution)
 }
 
 func (i *ICNS) highestResolutionAsset() (*Img, error) {
@@ -112,7 +288,7 @@ func (i *ICNS) highestResolutionAsset() (*Img, error) {
 	}
 
 	if img == nil {
-		return nil, fmt.Errorf("no valid image")
+		return nil, ErrNoImage
 	}
 	return img, nil
 }
@@ -124,61 +300,418 @@ func (i *ICNS) HighestResolution() (image.Image, error) {
 		return nil, err
 	}
 
-	return img.Image, nil
+	return img.AsImage()
+}
+
+// ReplacePolicy controls how Add handles formats that already hold an image.
+type ReplacePolicy int
+
+const (
+	// ReplaceExisting replaces the images of the formats. This is the default.
+	ReplaceExisting ReplacePolicy = iota
+	// SkipExisting keeps the existing images, only adding to formats without one.
+	SkipExisting
+	// ErrorOnExisting makes Add fail with ErrImageExists, leaving the icon unmodified.
+	ErrorOnExisting
+)
+
+// AddOption is the type for Add options.
+type AddOption func(*addOptions)
+
+type addOptions struct {
+	replace ReplacePolicy
+}
+
+// WithReplacePolicy sets how formats that already hold an image are handled.
+func WithReplacePolicy(p ReplacePolicy) AddOption {
+	return func(o *addOptions) {
+		o.replace = p
+	}
 }
 
 // Add adds new image to the icon, assuming its resolution is acceptable.
-// This also replaces previous images at that resolution.
-func (i *ICNS) Add(im image.Image) error {
+// By default, this also replaces previous images at that resolution.
+func (i *ICNS) Add(im image.Image, opts ...AddOption) error {
+	var o addOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	im = i.square(im)
 	dx := im.Bounds().Dx()
 	dy := im.Bounds().Dy()
 
 	if dx != dy {
-		return fmt.Errorf("image is not a square")
+		return ErrNotSquare
 	}
 
-	var supported bool
+	var formats []*Format
 	for _, f := range supportedImageFormats {
-		if f.Compat < i.minCompat || f.Compat > i.maxCompat {
-			continue
+		if f.Compat >= i.minCompat && f.Compat <= i.maxCompat && f.Res == Resolution(dx) {
+			formats = append(formats, f)
 		}
+	}
+	if len(formats) == 0 {
+		return fmt.Errorf("resolution %d: %w", dx, ErrUnsupportedResolution)
+	}
 
-		if f.Res == Resolution(dx) {
-			supported = true
+	if o.replace == ErrorOnExisting {
+		for _, f := range formats {
+			if a, _ := i.ByCode(f.Code); a != nil {
+				return fmt.Errorf("%s: %w", CodeString(f.Code), ErrImageExists)
+			}
+		}
+	}
 
-			var found bool
-			for _, a := range i.Assets {
-				if a.Format == f {
-					found = true
+	for _, f := range formats {
+		var found bool
+		for _, a := range i.Assets {
+			if a.Format == f {
+				found = true
+				if o.replace == ReplaceExisting {
 					a.Image = im
+					a.mask = nil
 				}
 			}
+		}
 
-			if !found {
-				i.Assets = append(i.Assets, &Img{
-					Image:  im,
-					Format: f,
-				})
-			}
+		if !found {
+			i.Assets = append(i.Assets, &Img{
+				Image:  im,
+				Format: f,
+			})
 		}
 	}
 
-	if !supported {
-		return fmt.Errorf("no available format for resolution %d", dx)
+	return nil
+}
+
+// AddWithFormat adds an image to the icon under the provided code only, whatever the
+// compatibility range of the icon, unlike Add which fills every format of the resolution.
+// This allows storing different artwork for formats sharing a pixel size, such as
+// icp5 (32pt@1x) and ic11 (16pt@2x). The replace policy of the options applies to the code.
+func (i *ICNS) AddWithFormat(im image.Image, code uint32, opts ...AddOption) error {
+	var o addOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
 
+	f, ok := supportedImageFormats[code]
+	if !ok {
+		return &UnsupportedChunkError{Code: code}
+	}
+	im = i.square(im)
+	b := im.Bounds()
+	if b.Dx() != b.Dy() {
+		return ErrNotSquare
+	}
+	if b.Dx() != int(f.Res) {
+		return fmt.Errorf("image is %dx%d, want %dx%d for %s", b.Dx(), b.Dy(), f.Res, f.Res, CodeString(code))
+	}
+
+	if a, _ := i.ByCode(code); a != nil {
+		switch o.replace {
+		case ReplaceExisting:
+			a.Image = im
+			a.mask = nil
+		case ErrorOnExisting:
+			return fmt.Errorf("%s: %w", CodeString(code), ErrImageExists)
+		}
+		return nil
+	}
+	i.Assets = append(i.Assets, &Img{
+		Image:  im,
+		Format: f,
+	})
 	return nil
 }
 
+// Remove removes the images at the provided resolution, along with the raw elements
+// added for their formats and paired masks. It reports whether anything was removed.
+func (i *ICNS) Remove(r Resolution) bool {
+	return i.remove(func(f *Format) bool {
+		return f.Res == r
+	})
+}
+
+// RemoveByCode removes the image stored under the provided code, along with the raw elements
+// added for that code and its paired mask. It reports whether anything was removed.
+func (i *ICNS) RemoveByCode(code uint32) bool {
+	return i.remove(func(f *Format) bool {
+		return f.Code == code
+	})
+}
+
+func (i *ICNS) remove(match func(*Format) bool) bool {
+	var removed bool
+
+	assets := i.Assets[:0]
+	for _, a := range i.Assets {
+		if match(a.Format) {
+			removed = true
+			continue
+		}
+		assets = append(assets, a)
+	}
+	for idx := len(assets); idx < len(i.Assets); idx++ {
+		i.Assets[idx] = nil // let removed images be garbage collected
+	}
+	i.Assets = assets
+
+	codes := make(map[uint32]bool)
+	for _, f := range supportedImageFormats {
+		if match(f) {
+			codes[f.Code] = true
+			if f.CombineCode != 0 {
+				codes[f.CombineCode] = true
+			}
+		}
+	}
+
+	extra := i.extra[:0]
+	for _, c := range i.extra {
+		if codes[c.Code] {
+			removed = true
+			continue
+		}
+		extra = append(extra, c)
+	}
+	i.extra = extra
+
+	return removed
+}
+
+// Filter returns a new icon containing only the images for which keep returns true,
+// along with the raw elements of the icon, and its dark icon filtered the same way.
+// Images are shared with the original icon.
+func (i *ICNS) Filter(keep func(*Img) bool) *ICNS {
+	res := &ICNS{
+		minCompat:   i.minCompat,
+		maxCompat:   i.maxCompat,
+		scaler:      i.scaler,
+		linear:      i.linear,
+		pad:         i.pad,
+		chunks:      append([]Chunk(nil), i.chunks...),
+		unsupported: append([]Chunk(nil), i.unsupported...),
+		extra:       append([]Chunk(nil), i.extra...),
+	}
+	if i.dark != nil {
+		res.dark = i.dark.Filter(keep)
+	}
+
+	for _, a := range i.Assets {
+		if keep(a) {
+			res.Assets = append(res.Assets, a)
+		}
+	}
+	return res
+}
+
+// Clone returns a deep copy of the icon, that can be modified without affecting the original.
+func (i *ICNS) Clone() *ICNS {
+	res := &ICNS{
+		minCompat:   i.minCompat,
+		maxCompat:   i.maxCompat,
+		scaler:      i.scaler,
+		linear:      i.linear,
+		pad:         i.pad,
+		chunks:      cloneChunks(i.chunks),
+		unsupported: cloneChunks(i.unsupported),
+		extra:       cloneChunks(i.extra),
+	}
+	if i.dark != nil {
+		res.dark = i.dark.Clone()
+	}
+
+	for _, a := range i.Assets {
+		res.Assets = append(res.Assets, a.clone())
+	}
+	return res
+}
+
+// clone returns a deep copy of the asset.
+func (a *Img) clone() *Img {
+	img := a.Image
+	if _, ok := img.(*lazyImage); !ok {
+		img = utils.CloneImage(img) // lazily decoded images are never modified
+	}
+	c := &Img{
+		Image:    img,
+		Format:   a.Format,
+		Encoder:  a.Encoder,
+		Data:     cloneBytes(a.Data),
+		Encoding: a.Encoding,
+		mask:     utils.CloneImage(a.mask),
+		stored:   a.stored,
+	}
+	if a.unmodified() {
+		c.src = c.Image
+	}
+	return c
+}
+
+func cloneChunks(chunks []Chunk) []Chunk {
+	if chunks == nil {
+		return nil
+	}
+	res := make([]Chunk, len(chunks))
+	for idx, c := range chunks {
+		res[idx] = Chunk{
+			Code: c.Code,
+			Data: cloneBytes(c.Data),
+		}
+	}
+	return res
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// Merge adds copies of the images and raw elements of other to the icon. Images stored
+// under a code already present are replaced when overwrite is set, and ignored otherwise.
+// The compatibility range of the icon is extended to include the one of other.
+func (i *ICNS) Merge(other *ICNS, overwrite bool) {
+	for _, o := range other.Assets {
+		var found bool
+		for idx, cur := range i.Assets {
+			if cur.Format.Code == o.Format.Code {
+				found = true
+				if overwrite {
+					i.Assets[idx] = o.clone()
+				}
+				break
+			}
+		}
+
+		if !found {
+			i.Assets = append(i.Assets, o.clone())
+		}
+	}
+
+	switch {
+	case other.dark == nil:
+	case i.dark == nil:
+		i.dark = other.dark.Clone()
+	default:
+		i.dark.Merge(other.dark, overwrite)
+	}
+
+	i.unsupported = mergeChunks(i.unsupported, other.unsupported, overwrite)
+	i.extra = mergeChunks(i.extra, other.extra, overwrite)
+
+	if other.minCompat < i.minCompat {
+		i.minCompat = other.minCompat
+	}
+	if other.maxCompat > i.maxCompat {
+		i.maxCompat = other.maxCompat
+	}
+}
+
+func mergeChunks(dst, src []Chunk, overwrite bool) []Chunk {
+	for _, c := range src {
+		var found bool
+		for idx := range dst {
+			if dst[idx].Code == c.Code {
+				found = true
+				if overwrite {
+					dst[idx] = c
+				}
+				break
+			}
+		}
+
+		if !found {
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
 // Info provides information about the ICNS
 func (i *ICNS) Info() string {
 	buf := new(bytes.Buffer)
-	fmt.Fprintf(buf, "%d images:\n", len(i.Assets)+len(i.unsupportedCodes))
+	fmt.Fprintf(buf, "%d images:\n", len(i.Assets)+len(i.unsupported))
 	for _, a := range i.Assets {
-		fmt.Fprintf(buf, "[%s] %s image with resolution %d\n", codeRepr(a.Format.Code), a.Encoder, a.Image.Bounds().Dx())
+		res := int(a.Format.Res)
+		if a.Image != nil { // not decoded, so that Info keeps lazy images as they are
+			res = a.Image.Bounds().Dx()
+		}
+		fmt.Fprintf(buf, "[%s] %s image with resolution %d\n", CodeString(a.Format.Code), a.Encoder, res)
 	}
-	for _, c := range i.unsupportedCodes {
-		fmt.Fprintf(buf, "[%s] unsupported image format\n", codeRepr(c))
+	for _, c := range i.unsupported {
+		fmt.Fprintf(buf, "[%s] unsupported image format\n", CodeString(c.Code))
 	}
 	return buf.String()
 }
+
+// ImageInfo describes an image of an icon, as listed by InfoReport.
+type ImageInfo struct {
+	Code       string        `json:"code"`
+	Encoding   Encoding      `json:"encoding"`
+	Resolution Resolution    `json:"resolution"`
+	Size       int           `json:"size"` // bytes of data read from the source file, 0 for new images
+	Compat     Compatibility `json:"compat"`
+
+	// Unsupported is set for the elements of the source file whose code is not supported.
+	// Only their code and size are reported.
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+// InfoReport describes the images of the icon, as Info does, in a form suited to
+// programs. The encoding is the one of the source file when the image was read from
+// one, and the one used by Encode otherwise.
+func (i *ICNS) InfoReport() []ImageInfo {
+	res := make([]ImageInfo, 0, len(i.Assets)+len(i.unsupported))
+	for _, a := range i.Assets {
+		info := ImageInfo{
+			Code:       CodeString(a.Format.Code),
+			Encoding:   a.stored,
+			Resolution: a.Format.Res,
+			Size:       len(a.Data),
+			Compat:     a.Format.Compat,
+		}
+		if !a.unmodified() || a.Encoding != EncodingAuto {
+			info.Encoding = a.Encoding
+			if info.Encoding == EncodingAuto {
+				info.Encoding = a.Format.defaultEncoding()
+			}
+		}
+		res = append(res, info)
+	}
+	for _, c := range i.unsupported {
+		res = append(res, ImageInfo{
+			Code:        CodeString(c.Code),
+			Size:        len(c.Data),
+			Unsupported: true,
+		})
+	}
+	return res
+}
+
+// RawChunks returns the elements of the icon as raw data: the ones read from the source file,
+// in their original order, followed by the ones added with AddRawChunk.
+// The returned data must not be modified.
+func (i *ICNS) RawChunks() []Chunk {
+	res := make([]Chunk, 0, len(i.chunks)+len(i.extra))
+	res = append(res, i.chunks...)
+	return append(res, i.extra...)
+}
+
+// UnsupportedChunks returns the elements of the source file whose code is not supported,
+// in their original order. The returned data must not be modified.
+func (i *ICNS) UnsupportedChunks() []Chunk {
+	return append([]Chunk(nil), i.unsupported...)
+}
+
+// AddRawChunk adds an element to the icon, that is written as is by Encode, after the assets.
+// No validation of the code or data is performed.
+func (i *ICNS) AddRawChunk(code uint32, data []byte) {
+	i.extra = append(i.extra, Chunk{
+		Code: code,
+		Data: data,
+	})
+}
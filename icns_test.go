@@ -0,0 +1,508 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestByPointSize(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		pt, scale uint
+		want      int
+	}{
+		{16, 1, 16},
+		{16, 2, 32},
+		{32, 1, 32},
+		{32, 2, 64},
+		{512, 2, 1024},
+	}
+
+	for _, tt := range data {
+		img, err := i.ByPointSize(tt.pt, tt.scale)
+		if err != nil {
+			t.Errorf("ByPointSize(%d, %d): %v", tt.pt, tt.scale, err)
+			continue
+		}
+		if got := img.Bounds().Dx(); got != tt.want {
+			t.Errorf("ByPointSize(%d, %d): got %dpx, want %dpx", tt.pt, tt.scale, got, tt.want)
+		}
+	}
+
+	if _, err := i.ByPointSize(64, 1); err == nil {
+		t.Error("ByPointSize(64, 1): expected an error for a missing point size")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !i.Remove(Pixel256) {
+		t.Fatal("Remove(256) removed nothing")
+	}
+	if _, err := i.ByResolution(Pixel256); err == nil {
+		t.Error("256px image still present after Remove")
+	}
+	if len(i.Assets) != 8 {
+		t.Errorf("got %d assets, want 8", len(i.Assets))
+	}
+
+	if !i.RemoveByCode(CodeIc11) {
+		t.Fatal("RemoveByCode(ic11) removed nothing")
+	}
+	if _, err := i.ByPointSize(16, 2); err == nil {
+		t.Error("ic11 image still present after RemoveByCode")
+	}
+	if _, err := i.ByPointSize(32, 1); err != nil {
+		t.Errorf("ic05 image removed along ic11: %v", err)
+	}
+
+	if i.RemoveByCode(CodeIc11) {
+		t.Error("RemoveByCode(ic11) removed something twice")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	full, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewICNS(WithMinCompatibility(Lion))
+	small := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	if err := i.Add(small); err != nil {
+		t.Fatal(err)
+	}
+
+	i.Merge(full, false)
+	if len(i.Assets) != len(full.Assets) {
+		t.Fatalf("got %d assets, want %d", len(i.Assets), len(full.Assets))
+	}
+	if img, _ := i.ByResolution(Pixel128); img != small {
+		t.Error("existing 128px image replaced without overwrite")
+	}
+	if i.minCompat != Cheetah {
+		t.Errorf("compatibility not extended: got %d, want %d", i.minCompat, Cheetah)
+	}
+
+	i.Merge(full, true)
+	if img, _ := i.ByResolution(Pixel128); img == small {
+		t.Error("existing 128px image kept with overwrite")
+	}
+
+	// the merged images are copies
+	other := NewICNS(WithMinCompatibility(Lion))
+	if err := other.Add(image.NewNRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	src := other.Assets[0].Image
+	i.Merge(other, true)
+	a, err := i.ByCode(other.Assets[0].Format.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Image.(draw.Image).Set(0, 0, color.NRGBA{R: 0xff, A: 0xff})
+	if _, _, _, a := src.At(0, 0).RGBA(); a != 0 {
+		t.Error("merged image shared with the other icon")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := i.Filter(func(a *Img) bool {
+		return a.Format.Res >= Pixel128 && a.Encoder == "png"
+	})
+	if len(large.Assets) != 6 {
+		t.Errorf("got %d assets, want 6", len(large.Assets))
+	}
+	for _, a := range large.Assets {
+		if a.Format.Res < Pixel128 {
+			t.Errorf("unexpected %s asset after filtering", CodeString(a.Format.Code))
+		}
+	}
+	if len(i.Assets) != 10 {
+		t.Errorf("original icon modified by Filter")
+	}
+	if got, want := len(large.RawChunks()), len(i.RawChunks()); got != want {
+		t.Errorf("got %d raw chunks, want %d", got, want)
+	}
+
+	i.DeriveDark(InvertLuminance)
+	large = i.Filter(func(a *Img) bool {
+		return a.Format.Res >= Pixel128
+	})
+	if large.Dark() == i.Dark() {
+		t.Fatal("dark icon shared by Filter")
+	}
+	for _, a := range large.Dark().Assets {
+		if a.Format.Res < Pixel128 {
+			t.Errorf("unexpected %s dark asset after filtering", CodeString(a.Format.Code))
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := i.Clone()
+	if len(c.Assets) != len(i.Assets) {
+		t.Fatalf("got %d assets, want %d", len(c.Assets), len(i.Assets))
+	}
+	for idx, a := range c.Assets {
+		if a.Format != i.Assets[idx].Format || !bytes.Equal(a.Data, i.Assets[idx].Data) {
+			t.Errorf("asset %d differs after Clone", idx)
+		}
+	}
+
+	c.Assets[0].Data[0] ^= 0xff
+	c.Assets[0].Image.(*image.NRGBA).Pix[0] ^= 0xff
+	c.RemoveByCode(CodeIc10)
+	if i.Assets[0].Data[0] == c.Assets[0].Data[0] {
+		t.Error("asset data shared between clones")
+	}
+	if i.Assets[0].Image.(*image.NRGBA).Pix[0] == c.Assets[0].Image.(*image.NRGBA).Pix[0] {
+		t.Error("asset image shared between clones")
+	}
+	if len(i.Assets) != 10 {
+		t.Error("asset list shared between clones")
+	}
+}
+
+func TestCompatibility(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if min, max := i.Compatibility(); min != Cheetah || max != MountainLion {
+		t.Errorf("Compatibility(): got (%d, %d), want (%d, %d)", min, max, Cheetah, MountainLion)
+	}
+}
+
+func TestUnsupportedChunks(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := i.UnsupportedChunks()
+	if len(chunks) != 1 || CodeString(chunks[0].Code) != "info" {
+		t.Fatalf("unexpected unsupported chunks: %v", chunks)
+	}
+	if !bytes.HasPrefix(chunks[0].Data, []byte("bplist")) {
+		t.Errorf("unexpected info data: %q", chunks[0].Data[:8])
+	}
+}
+
+func TestByCode(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := i.ByCode(CodeIc05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format.Code != CodeIc05 || a.DataEncoding() != EncodingARGB || len(a.Data) == 0 {
+		t.Errorf("unexpected asset: %s %s, %d bytes", CodeString(a.Format.Code), a.DataEncoding(), len(a.Data))
+	}
+
+	if _, err := i.ByCode(CodeIcp5); err == nil {
+		t.Error("ByCode(icp5): expected an error for a missing code")
+	}
+}
+
+func TestAll(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for f, img := range i.All() {
+		if img.Bounds().Dx() != int(f.Res) {
+			t.Errorf("[%s] got %dpx, want %dpx", CodeString(f.Code), img.Bounds().Dx(), f.Res)
+		}
+		n++
+	}
+	if n != len(i.Assets) {
+		t.Errorf("got %d images, want %d", n, len(i.Assets))
+	}
+
+	for f := range i.Masks() {
+		t.Errorf("unexpected %s mask", CodeString(f.Code))
+	}
+}
+
+func TestAddReplacePolicy(t *testing.T) {
+	t.Parallel()
+	small := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for _, tc := range []struct {
+		policy  ReplacePolicy
+		err     error
+		kept    bool // whether ic04 keeps its decoded image
+		entries int  // number of images at 16px afterwards
+	}{
+		{ReplaceExisting, nil, false, 2},
+		{SkipExisting, nil, true, 2},
+		{ErrorOnExisting, ErrImageExists, true, 1},
+	} {
+		i, err := Decode(testdataFileReader(t, "mit.icns"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		old, _ := i.ByCode(CodeIc04)
+		img := old.Image
+
+		if err := i.Add(small, WithReplacePolicy(tc.policy)); !errors.Is(err, tc.err) {
+			t.Errorf("policy %d: got error %v, want %v", tc.policy, err, tc.err)
+		}
+		if kept := old.Image == img; kept != tc.kept {
+			t.Errorf("policy %d: ic04 image kept: %v, want %v", tc.policy, kept, tc.kept)
+		}
+		var n int
+		for _, a := range i.Assets {
+			if a.Format.Res == Pixel16 {
+				n++
+			}
+		}
+		if n != tc.entries {
+			t.Errorf("policy %d: got %d images at 16px, want %d", tc.policy, n, tc.entries)
+		}
+	}
+}
+
+func TestAddWithFormat(t *testing.T) {
+	t.Parallel()
+	i := NewICNS()
+	small := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	retina := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	if err := i.AddWithFormat(small, CodeIcp5); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.AddWithFormat(retina, CodeIc11); err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != 2 {
+		t.Fatalf("got %d images, want 2:\n%s", len(i.Assets), i.Info())
+	}
+	if img, _ := i.ByPointSize(32, 1); img != small {
+		t.Error("icp5 does not hold the 32pt@1x image")
+	}
+	if img, _ := i.ByPointSize(16, 2); img != retina {
+		t.Error("ic11 does not hold the 16pt@2x image")
+	}
+
+	if err := i.AddWithFormat(retina, CodeIcp5, WithReplacePolicy(ErrorOnExisting)); !errors.Is(err, ErrImageExists) {
+		t.Errorf("got %v, want ErrImageExists", err)
+	}
+	if err := i.AddWithFormat(retina, CodeIc07); err == nil {
+		t.Error("expected an error for a mismatched resolution")
+	}
+	var uerr *UnsupportedChunkError
+	if err := i.AddWithFormat(retina, CodeL8mk); !errors.As(err, &uerr) {
+		t.Errorf("got %v, want an UnsupportedChunkError for a mask code", err)
+	}
+}
+
+func TestImgMetadata(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	src.Pix[3] = 0xff // a single opaque pixel
+	i := NewICNS(WithMaxCompatibility(Allegro))
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	i, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := i.ByCode(CodeIl32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.MaskCode() != CodeL8mk || a.Mask() == nil || a.DataSize() != len(a.Data) || a.DataSize() == 0 {
+		t.Errorf("unexpected il32 metadata: mask %s, %d bytes", CodeString(a.MaskCode()), a.DataSize())
+	}
+	if !a.HasAlpha() {
+		t.Error("il32 image reported without alpha")
+	}
+
+	opaque := &Img{
+		Image:  image.NewGray(image.Rect(0, 0, 32, 32)),
+		Format: supportedImageFormats[CodeIcp5],
+	}
+	if opaque.HasAlpha() || opaque.MaskCode() != 0 || opaque.Mask() != nil || opaque.DataSize() != 0 {
+		t.Error("unexpected metadata for a new gray image")
+	}
+}
+
+func TestMissingFor(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range i.MissingFor(Cheetah, Newest) {
+		got = append(got, CodeString(f.Code))
+	}
+	if diff := cmp.Diff([]string{"icp4", "icp5", "icp6"}, got); diff != "" {
+		t.Errorf("MissingFor(Cheetah, Newest) mismatch (-want +got):\n%s", diff)
+	}
+
+	i.RemoveByCode(CodeIc10)
+	if got := i.MissingFor(Leopard, Leopard); len(got) != 0 {
+		t.Errorf("got missing formats for Leopard: %v", got)
+	}
+	if got := i.MissingFor(Lion, Lion); len(got) != 4 || got[3].Code != CodeIc10 {
+		t.Errorf("ic10 not reported missing for Lion: %v", got)
+	}
+}
+
+func TestInfoReport(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = i.Filter(func(a *Img) bool {
+		return a.Format.Code == CodeIc04 || a.Format.Code == CodeIc07
+	})
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(i.InfoReport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"code": "ic07", "encoding": "png", "resolution": "128", "size": 6529.0, "compat": "lion"},
+		{"code": "ic04", "encoding": "argb", "resolution": "16", "size": 781.0, "compat": "cheetah"},
+		{"code": "icp4", "encoding": "png", "resolution": "16", "size": 0.0, "compat": "lion"},
+		{"code": "info", "encoding": "auto", "resolution": "0", "size": 310.0, "compat": "allegro", "unsupported": true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("InfoReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompatibilityText(t *testing.T) {
+	t.Parallel()
+	for c := Oldest; c <= Newest; c++ {
+		text, err := c.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Compatibility
+		if err := got.UnmarshalText(text); err != nil || got != c {
+			t.Errorf("%s: got %v, %v after a round trip", text, got, err)
+		}
+	}
+
+	var min, max Compatibility
+	var size Resolution
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&min, "min-compat", "")
+	fs.Var(&max, "max-compat", "")
+	fs.Var(&size, "size", "")
+	if err := fs.Parse([]string{"--min-compat=Lion", "--max-compat=newest", "--size=256"}); err != nil {
+		t.Fatal(err)
+	}
+	if min != Lion || max != Newest || size != Pixel256 {
+		t.Errorf("got %s, %s and %s from flags", min, max, size)
+	}
+
+	var c Compatibility
+	if err := json.Unmarshal([]byte(`"snowleopard"`), &c); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+}
+
+func TestCompatibilityForVersion(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		version string
+		want    Compatibility
+		ok      bool
+	}{
+		{"8.5", Allegro, true},
+		{"9.2.2", Allegro, true},
+		{"10.0", Cheetah, true},
+		{"10.6", Leopard, true},
+		{"10.7", Lion, true},
+		{"macOS 12", MountainLion, true},
+		{"Mac OS X 10.4.11", Cheetah, true},
+		{"darwin 11.4.2", Lion, true},
+		{"Darwin21", MountainLion, true},
+		{"8.1", 0, false},
+		{"ten", 0, false},
+	} {
+		got, err := CompatibilityForVersion(tc.version)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("%q: got %s, %v", tc.version, got, err)
+		}
+	}
+
+	for c := Oldest; c <= Newest; c++ {
+		if got, err := CompatibilityForVersion(c.Version()); err != nil || got != c {
+			t.Errorf("%s: got %s, %v for version %s", c, got, err, c.Version())
+		}
+	}
+}
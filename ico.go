@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"github.com/kroksys/icns/internal/ico"
+	"github.com/kroksys/icns/internal/peres"
+)
+
+// FromICO creates an icon from the images of a Windows .ico file, stored as PNG or bitmap data.
+// Images whose size has no supported format are ignored. When several images have the same size,
+// the one with the most bits per pixel is used.
+func FromICO(r io.Reader, opts ...Option) (*ICNS, error) {
+	entries, err := ico.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ico file: %w", err)
+	}
+
+	// keep a single image of each size, so that the result does not depend on
+	// how Add handles formats that already hold an image
+	best := make(map[image.Point]int)
+	var kept []ico.Entry
+	for _, e := range entries {
+		size := e.Image.Bounds().Size()
+		if k, ok := best[size]; !ok {
+			best[size] = len(kept)
+			kept = append(kept, e)
+		} else if e.Bits > kept[k].Bits {
+			kept[k] = e
+		}
+	}
+
+	i := NewICNS(opts...)
+	for _, e := range kept {
+		// errors only mean that no format has that size
+		_ = i.Add(e.Image)
+	}
+	if len(i.Assets) == 0 {
+		return nil, fmt.Errorf("no image of the ico file has a supported size")
+	}
+	return i, nil
+}
+
+// EncodeICO writes a Windows .ico file made of the images of the icon at the provided sizes,
+// up to 256 pixels. Sizes without image are scaled from the closest larger one.
+// Without sizes, all the resolutions of the icon up to 256 pixels are written.
+func (i *ICNS) EncodeICO(w io.Writer, sizes ...int) error {
+	if len(i.Assets) == 0 {
+		return fmt.Errorf("no image to write")
+	}
+
+	if len(sizes) == 0 {
+		seen := make(map[int]bool)
+		for _, a := range i.Assets {
+			if r := int(a.Format.Res); r <= 256 && !seen[r] {
+				seen[r] = true
+				sizes = append(sizes, r)
+			}
+		}
+		if len(sizes) == 0 {
+			sizes = append(sizes, 256)
+		}
+	}
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+
+	var images []image.Image
+	for idx, size := range sizes {
+		if size <= 0 || size > 256 {
+			return fmt.Errorf("invalid ico size %d", size)
+		}
+		if idx > 0 && size == sizes[idx-1] {
+			continue
+		}
+		_, src, err := i.scaleSource(Resolution(size))
+		if err != nil {
+			return err
+		}
+		images = append(images, i.resize(src, Resolution(size)))
+	}
+	return ico.Encode(w, images)
+}
+
+// FromEXE creates an icon from the first icon group of the resources of a Windows
+// executable or library, as shown for the application by Windows.
+func FromEXE(r io.ReaderAt, size int64, opts ...Option) (*ICNS, error) {
+	groups, err := peres.Icons(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read executable resources: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no icon in the executable")
+	}
+	return FromICO(bytes.NewReader(groups[0]), opts...)
+}
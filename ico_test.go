@@ -0,0 +1,252 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+// icoFile builds a Windows icon file made of the provided entries.
+func icoFile(entries ...[]byte) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint16{0, 1, uint16(len(entries))})
+	offset := 6 + 16*len(entries)
+	for _, e := range entries {
+		binary.Write(buf, binary.LittleEndian, []uint8{0, 0, 0, 0})
+		binary.Write(buf, binary.LittleEndian, []uint16{1, 32})
+		binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(e)), uint32(offset)})
+		offset += len(e)
+	}
+	for _, e := range entries {
+		buf.Write(e)
+	}
+	return buf.Bytes()
+}
+
+// dibEntry builds a 8-bit paletted bitmap entry, whose left half is red and transparent
+// according to the mask, and right half is blue.
+func dibEntry(size int) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{40, uint32(size), uint32(2 * size)})
+	binary.Write(buf, binary.LittleEndian, []uint16{1, 8})
+	binary.Write(buf, binary.LittleEndian, []uint32{0, 0, 0, 0, 2, 0})
+	buf.Write([]byte{0, 0, 0xff, 0, 0xff, 0, 0, 0}) // BGRX palette: red, blue
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			buf.WriteByte(byte(x * 2 / size))
+		}
+	}
+	maskStride := (size + 31) / 32 * 4
+	for y := 0; y < size; y++ {
+		row := make([]byte, maskStride)
+		for x := 0; x < size/2; x++ {
+			row[x/8] |= 0x80 >> (x % 8)
+		}
+		buf.Write(row)
+	}
+	return buf.Bytes()
+}
+
+func TestFromICO(t *testing.T) {
+	t.Parallel()
+	png256 := new(bytes.Buffer)
+	if err := png.Encode(png256, image.NewNRGBA(image.Rect(0, 0, 256, 256))); err != nil {
+		t.Fatal(err)
+	}
+
+	data := icoFile(dibEntry(32), dibEntry(24), png256.Bytes())
+	i, err := FromICO(bytes.NewReader(data), WithMinCompatibility(Lion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.ByResolution(Pixel256); err != nil {
+		t.Error(err)
+	}
+	img, err := i.ByResolution(Pixel32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.NRGBA
+	}{
+		{0, 0, color.NRGBA{R: 0xff}},
+		{31, 0, color.NRGBA{B: 0xff, A: 0xff}},
+		{16, 31, color.NRGBA{B: 0xff, A: 0xff}},
+	} {
+		if got := color.NRGBAModel.Convert(img.At(tc.x, tc.y)); got != tc.want {
+			t.Errorf("(%d, %d): got %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// the 32-bit image is kept over the 8-bit one of the same size, whatever their order
+	green := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for p := 0; p < len(green.Pix); p += 4 {
+		copy(green.Pix[p:], []byte{0, 0xff, 0, 0xff})
+	}
+	png32 := new(bytes.Buffer)
+	if err := png.Encode(png32, green); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{
+		icoFile(png32.Bytes(), dibEntry(32)),
+		icoFile(dibEntry(32), png32.Bytes()),
+	} {
+		i, err := FromICO(bytes.NewReader(data), WithMinCompatibility(Lion))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := i.ByResolution(Pixel32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := color.NRGBAModel.Convert(img.At(0, 0)), (color.NRGBA{G: 0xff, A: 0xff}); got != want {
+			t.Errorf("got %v, want the 32-bit image", got)
+		}
+	}
+
+	if _, err := FromICO(bytes.NewReader(icoFile(dibEntry(24)))); err == nil {
+		t.Error("expected an error without any supported size")
+	}
+	if _, err := FromICO(bytes.NewReader(data[:40])); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+}
+
+func TestEncodeICO(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := i.EncodeICO(buf, 256, 48, 16); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if n := binary.LittleEndian.Uint16(data[4:]); n != 3 {
+		t.Fatalf("got %d entries, want 3", n)
+	}
+	if off := binary.LittleEndian.Uint32(data[6+2*16+12:]); !bytes.HasPrefix(data[off:], []byte("\x89PNG")) {
+		t.Error("256px entry not stored as PNG")
+	}
+
+	dec, err := FromICO(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range []Resolution{Pixel16, Pixel48, Pixel256} {
+		want, err := i.ByResolution(res)
+		if err != nil {
+			if res == Pixel48 {
+				continue // scaled from a larger image
+			}
+			t.Fatal(err)
+		}
+		got, err := dec.ByResolution(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utils.EqualImages(utils.Img2NRGBA(got), utils.Img2NRGBA(want)) {
+			t.Errorf("%dpx: image modified by the conversion", res)
+		}
+	}
+
+	if err := i.EncodeICO(buf, 512); err == nil {
+		t.Error("expected an error for a size over 256")
+	}
+}
+
+// peFile builds a minimal executable whose resources hold an icon group made of a single icon.
+func peFile(icon []byte, size int) []byte {
+	const rva = 0x1000
+	le := binary.LittleEndian
+
+	dir := func(id, offset uint32) []byte {
+		b := make([]byte, 24)
+		le.PutUint16(b[14:], 1)
+		le.PutUint32(b[16:], id)
+		le.PutUint32(b[20:], offset)
+		return b
+	}
+	group := make([]byte, 6+14)
+	le.PutUint16(group[2:], 1)
+	le.PutUint16(group[4:], 1)
+	group[6], group[7] = uint8(size), uint8(size)
+	le.PutUint16(group[10:], 1)
+	le.PutUint16(group[12:], 8)
+	le.PutUint32(group[14:], uint32(len(icon)))
+	le.PutUint16(group[18:], 1)
+
+	rsrc := new(bytes.Buffer)
+	root := make([]byte, 32)
+	le.PutUint16(root[14:], 2)
+	le.PutUint32(root[16:], 3) // RT_ICON
+	le.PutUint32(root[20:], 0x80000000|32)
+	le.PutUint32(root[24:], 14) // RT_GROUP_ICON
+	le.PutUint32(root[28:], 0x80000000|56)
+	rsrc.Write(root)
+	rsrc.Write(dir(1, 0x80000000|80))
+	rsrc.Write(dir(1, 0x80000000|104))
+	rsrc.Write(dir(0x409, 128))
+	rsrc.Write(dir(0x409, 144))
+	binary.Write(rsrc, le, []uint32{rva + 160, uint32(len(icon)), 0, 0})
+	binary.Write(rsrc, le, []uint32{rva + 160 + uint32(len(icon)), uint32(len(group)), 0, 0})
+	rsrc.Write(icon)
+	rsrc.Write(group)
+
+	file := make([]byte, 0x200)
+	copy(file, "MZ")
+	le.PutUint32(file[0x3c:], 0x40)
+	copy(file[0x40:], "PE\x00\x00")
+	le.PutUint16(file[0x44:], 0x14c) // i386
+	le.PutUint16(file[0x46:], 1)     // sections
+	le.PutUint16(file[0x56:], 0x2)   // executable
+	s := file[0x58:]
+	copy(s, ".rsrc")
+	le.PutUint32(s[8:], uint32(rsrc.Len()))
+	le.PutUint32(s[12:], rva)
+	le.PutUint32(s[16:], uint32(rsrc.Len()))
+	le.PutUint32(s[20:], 0x200)
+	return append(file, rsrc.Bytes()...)
+}
+
+func TestFromEXE(t *testing.T) {
+	t.Parallel()
+	data := peFile(dibEntry(32), 32)
+	i, err := FromEXE(bytes.NewReader(data), int64(len(data)), WithMinCompatibility(Lion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := i.ByResolution(Pixel32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := color.NRGBAModel.Convert(img.At(31, 0)), (color.NRGBA{B: 0xff, A: 0xff}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := FromEXE(bytes.NewReader(data[:0x200]), 0x200); err == nil {
+		t.Error("expected an error for a truncated executable")
+	}
+}
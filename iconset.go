@@ -0,0 +1,156 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kroksys/icns/codec"
+)
+
+// iconsetFiles maps the file names of an .iconset directory to the formats used by iconutil.
+var iconsetFiles = []struct {
+	name string
+	code uint32
+}{
+	{"icon_16x16.png", CodeIc04},
+	{"icon_16x16@2x.png", CodeIc11},
+	{"icon_32x32.png", CodeIc05},
+	{"icon_32x32@2x.png", CodeIc12},
+	{"icon_128x128.png", CodeIc07},
+	{"icon_128x128@2x.png", CodeIc13},
+	{"icon_256x256.png", CodeIc08},
+	{"icon_256x256@2x.png", CodeIc14},
+	{"icon_512x512.png", CodeIc09},
+	{"icon_512x512@2x.png", CodeIc10},
+}
+
+// FromIconset creates an icon from the PNG files of an .iconset directory, such as
+// icon_32x32@2x.png, using the same formats as iconutil. Missing files are skipped.
+// The data of the files is written as is by Encode, when the format stores PNG data.
+func FromIconset(fsys fs.FS) (*ICNS, error) {
+	i := &ICNS{
+		minCompat: Newest,
+		maxCompat: Oldest,
+	}
+
+	for _, file := range iconsetFiles {
+		data, err := fs.ReadFile(fsys, file.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := i.addPNG(supportedImageFormats[file.code], data); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+
+	if len(i.Assets) == 0 {
+		return nil, fmt.Errorf("no icon file found")
+	}
+	return i, nil
+}
+
+// addPNG adds the PNG data as an image of format f, extending the compatibility
+// range of the icon. The data is kept to be written as is when f stores PNG data.
+func (i *ICNS) addPNG(f *Format, data []byte) error {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if b := img.Bounds(); b.Dx() != int(f.Res) || b.Dy() != int(f.Res) {
+		return fmt.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), f.Res, f.Res)
+	}
+
+	a := &Img{
+		Image:   img,
+		Format:  f,
+		Encoder: "png",
+	}
+	if f.Codec == codec.ImageCodec {
+		a.Data = data
+		a.src = img
+		a.stored = EncodingPNG
+	}
+	i.Assets = append(i.Assets, a)
+
+	i.minCompat = min(i.minCompat, f.Compat)
+	i.maxCompat = max(i.maxCompat, f.Compat)
+	return nil
+}
+
+// WriteIconset writes the images of the icon to an .iconset directory, created if needed,
+// with the file names expected by iconutil. Each file holds the image with the matching
+// point size and scale, preferring the format used by iconutil.
+func (i *ICNS) WriteIconset(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, file := range iconsetFiles {
+		a := i.iconsetImage(supportedImageFormats[file.code])
+		if a == nil {
+			continue
+		}
+		data, err := pngData(a)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iconsetImage returns the image with the point size and scale of f, preferring f itself,
+// then modern formats.
+func (i *ICNS) iconsetImage(f *Format) *Img {
+	var best *Img
+	for _, a := range i.Assets {
+		if a.Format.PointSize != f.PointSize || a.Format.Scale != f.Scale {
+			continue
+		}
+		if best == nil || a.Format == f || (best.Format != f && best.Format.legacy() && !a.Format.legacy()) {
+			best = a
+		}
+	}
+	return best
+}
+
+// pngData returns the image as PNG data, reusing the data read from the source file when possible.
+func pngData(a *Img) ([]byte, error) {
+	if a.unmodified() && bytes.HasPrefix(a.Data, pngHeader) {
+		return a.Data, nil
+	}
+	img, err := a.AsImage()
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestFromIconset(t *testing.T) {
+	t.Parallel()
+	i, err := FromIconset(os.DirFS("testdata/mit.iconset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(i.Assets) != len(want.Assets) {
+		t.Fatalf("got %d images, want %d:\n%s", len(i.Assets), len(want.Assets), i.Info())
+	}
+	for _, w := range want.Assets {
+		a, err := i.ByCode(w.Format.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// iconutil rounds a few colors of ARGB images differently
+		got, exp := utils.Img2NRGBA(a.Image), utils.Img2NRGBA(w.Image)
+		for idx := range got.Pix {
+			if d := int(got.Pix[idx]) - int(exp.Pix[idx]); d < -1 || d > 1 {
+				t.Errorf("[%s] image differs from iconutil", CodeString(w.Format.Code))
+				break
+			}
+		}
+	}
+	if min, max := i.Compatibility(); min != Cheetah || max != MountainLion {
+		t.Errorf("got compatibility %v-%v, want %v-%v", min, max, Cheetah, MountainLion)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(buf, WithStrictDecoding()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := FromIconset(fstest.MapFS{}); err == nil {
+		t.Error("expected an error for an empty iconset")
+	}
+	bad := fstest.MapFS{"icon_32x32.png": &fstest.MapFile{Data: []byte("not a png")}}
+	if _, err := FromIconset(bad); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+}
+
+func TestWriteIconset(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "mit.iconset")
+	if err := i.WriteIconset(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range iconsetFiles {
+		if _, err := os.Stat(filepath.Join(dir, file.name)); err != nil {
+			t.Error(err)
+		}
+	}
+	a, err := i.ByCode(CodeIc10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "icon_512x512@2x.png")); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, a.Data) {
+		t.Error("PNG data not written as is")
+	}
+
+	back, err := FromIconset(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range i.Assets {
+		a, err := back.ByCode(w.Format.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utils.EqualImages(utils.Img2NRGBA(a.Image), utils.Img2NRGBA(w.Image)) {
+			t.Errorf("[%s] image modified by the round trip", CodeString(w.Format.Code))
+		}
+	}
+}
@@ -21,18 +21,27 @@ import (
 	"github.com/kroksys/icns/internal/utils"
 )
 
+// Reader reads big-endian values from a byte slice.
+// All methods check bounds and return io.ErrUnexpectedEOF rather than panicking
+// when the data is too short.
 type Reader []byte
 
-func (r *Reader) Uint32() uint32 {
+func (r *Reader) Uint32() (uint32, error) {
+	if len(*r) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
 	v := binary.BigEndian.Uint32(*r)
 	*r = (*r)[4:]
-	return v
+	return v, nil
 }
 
-func (r *Reader) Section(n int) *Reader {
-	r2 := (*r)[:n]
+func (r *Reader) Section(n int) (*Reader, error) {
+	if n < 0 || n > len(*r) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r2 := (*r)[:n:n]
 	*r = (*r)[n:]
-	return &r2
+	return &r2, nil
 }
 
 func (r *Reader) Read(p []byte) (int, error) {
@@ -42,9 +51,7 @@ func (r *Reader) Read(p []byte) (int, error) {
 	if n == nr {
 		err = io.EOF
 	}
-	s := r.Section(n)
-	for i := 0; i < n; i++ {
-		p[i] = (*s)[i]
-	}
+	copy(p, *r)
+	*r = (*r)[n:]
 	return n, err
 }
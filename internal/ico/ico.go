@@ -0,0 +1,240 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ico reads and writes Windows icon files.
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// Entry is an image of an icon file.
+type Entry struct {
+	Image image.Image
+	Bits  int // bits per pixel of the stored image
+}
+
+// Decode reads all the images of an icon file.
+func Decode(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if binary.LittleEndian.Uint16(data[0:]) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, fmt.Errorf("not an icon file")
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if len(data) < 6+16*count {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	res := make([]Entry, 0, count)
+	for idx := 0; idx < count; idx++ {
+		dir := data[6+16*idx:]
+		bits := int(binary.LittleEndian.Uint16(dir[6:]))
+		size := int64(binary.LittleEndian.Uint32(dir[8:]))
+		offset := int64(binary.LittleEndian.Uint32(dir[12:]))
+		if offset+size > int64(len(data)) {
+			return nil, fmt.Errorf("entry %d: %w", idx, io.ErrUnexpectedEOF)
+		}
+		body := data[offset : offset+size]
+
+		var img image.Image
+		if bytes.HasPrefix(body, pngHeader) {
+			img, err = png.Decode(bytes.NewReader(body))
+		} else {
+			img, bits, err = decodeDIB(body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", idx, err)
+		}
+		res = append(res, Entry{Image: img, Bits: bits})
+	}
+	return res, nil
+}
+
+// decodeDIB decodes a bitmap without file header, whose height covers both
+// the color data and the 1-bit transparency mask.
+func decodeDIB(b []byte) (image.Image, int, error) {
+	if len(b) < 40 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	hdrSize := int(binary.LittleEndian.Uint32(b[0:]))
+	w := int(int32(binary.LittleEndian.Uint32(b[4:])))
+	h := int(int32(binary.LittleEndian.Uint32(b[8:]))) / 2
+	bits := int(binary.LittleEndian.Uint16(b[14:]))
+	compression := binary.LittleEndian.Uint32(b[16:])
+	colors := int(binary.LittleEndian.Uint32(b[32:]))
+	if hdrSize < 40 || hdrSize > len(b) || w <= 0 || h <= 0 || w > 1024 || h > 1024 {
+		return nil, 0, fmt.Errorf("invalid bitmap header")
+	}
+	if compression != 0 {
+		return nil, 0, fmt.Errorf("unsupported bitmap compression %d", compression)
+	}
+
+	var palette color.Palette
+	p := b[hdrSize:]
+	if bits <= 8 {
+		if colors == 0 {
+			colors = 1 << bits
+		}
+		if len(p) < 4*colors {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		for idx := 0; idx < colors; idx++ {
+			palette = append(palette, color.NRGBA{R: p[4*idx+2], G: p[4*idx+1], B: p[4*idx], A: 0xff})
+		}
+		p = p[4*colors:]
+	}
+
+	switch bits {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, 0, fmt.Errorf("unsupported bitmap depth %d", bits)
+	}
+	stride := (w*bits + 31) / 32 * 4
+	maskStride := (w + 31) / 32 * 4
+	if len(p) < stride*h {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	mask := p[stride*h:]
+	hasMask := len(mask) >= maskStride*h
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	var alpha bool
+	for y := 0; y < h; y++ {
+		row := p[(h-1-y)*stride:] // rows are stored bottom-up
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+			switch bits {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				alpha = alpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				ppb := 8 / bits // pixels per byte
+				v := int(row[x/ppb]>>(8-bits*(x%ppb+1))) & (1<<bits - 1)
+				if v < len(palette) {
+					c = palette[v].(color.NRGBA)
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// the mask only applies when the color data has no alpha channel
+	if !alpha {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				a := uint8(0xff)
+				if hasMask && mask[(h-1-y)*maskStride+x/8]&(0x80>>(x%8)) != 0 {
+					a = 0
+				}
+				img.Pix[y*img.Stride+4*x+3] = a
+			}
+		}
+	}
+	return img, bits, nil
+}
+
+// Encode writes an icon file made of the provided images, which are stored as PNG data
+// from 256 pixels, and as 32-bit bitmaps below.
+func Encode(w io.Writer, images []image.Image) error {
+	bodies := make([][]byte, len(images))
+	for idx, img := range images {
+		b := img.Bounds()
+		if b.Dx() > 256 || b.Dy() > 256 {
+			return fmt.Errorf("image %d: %dx%d exceeds 256x256", idx, b.Dx(), b.Dy())
+		}
+		if b.Dx() >= 256 {
+			buf := new(bytes.Buffer)
+			if err := png.Encode(buf, img); err != nil {
+				return fmt.Errorf("image %d: %w", idx, err)
+			}
+			bodies[idx] = buf.Bytes()
+		} else {
+			bodies[idx] = encodeDIB(img)
+		}
+	}
+
+	hdr := make([]byte, 6+16*len(images))
+	binary.LittleEndian.PutUint16(hdr[2:], 1)
+	binary.LittleEndian.PutUint16(hdr[4:], uint16(len(images)))
+	offset := len(hdr)
+	for idx, img := range images {
+		b := img.Bounds()
+		dir := hdr[6+16*idx:]
+		dir[0] = uint8(b.Dx()) // 256 is stored as 0
+		dir[1] = uint8(b.Dy())
+		binary.LittleEndian.PutUint16(dir[4:], 1)
+		binary.LittleEndian.PutUint16(dir[6:], 32)
+		binary.LittleEndian.PutUint32(dir[8:], uint32(len(bodies[idx])))
+		binary.LittleEndian.PutUint32(dir[12:], uint32(offset))
+		offset += len(bodies[idx])
+	}
+
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	for _, body := range bodies {
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeDIB encodes a 32-bit bitmap without file header, followed by its transparency mask.
+func encodeDIB(img image.Image) []byte {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	stride := 4 * w
+	maskStride := (w + 31) / 32 * 4
+
+	res := make([]byte, 40+stride*h+maskStride*h)
+	binary.LittleEndian.PutUint32(res[0:], 40)
+	binary.LittleEndian.PutUint32(res[4:], uint32(w))
+	binary.LittleEndian.PutUint32(res[8:], uint32(2*h))
+	binary.LittleEndian.PutUint16(res[12:], 1)
+	binary.LittleEndian.PutUint16(res[14:], 32)
+	binary.LittleEndian.PutUint32(res[20:], uint32((stride+maskStride)*h))
+
+	pix := res[40:]
+	mask := pix[stride*h:]
+	for y := 0; y < h; y++ {
+		row := pix[(h-1-y)*stride:] // rows are stored bottom-up
+		mrow := mask[(h-1-y)*maskStride:]
+		for x := 0; x < w; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = c.B, c.G, c.R, c.A
+			if c.A == 0 {
+				mrow[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,213 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package peres extracts icons from the resources of Windows PE executables.
+package peres
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	rtIcon      = 3
+	rtGroupIcon = 14
+)
+
+// resources is the resource section of an executable.
+type resources struct {
+	data []byte
+	rva  uint32 // virtual address of the section
+}
+
+// Icons returns the icon groups of the executable, each one as the content of an .ico file.
+// Broken groups are skipped; the error of the first one is returned if no group is valid.
+func Icons(r io.ReaderAt) ([][]byte, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := resourceSection(f)
+	if s == nil {
+		return nil, fmt.Errorf("no resource section")
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	res := &resources{data: data, rva: s.VirtualAddress}
+
+	icons := make(map[uint32][]byte)
+	if err := res.walk(rtIcon, func(id uint32, b []byte) error {
+		icons[id] = b
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var groups [][]byte
+	var broken error
+	err = res.walk(rtGroupIcon, func(_ uint32, b []byte) error {
+		ico, err := groupToICO(b, icons)
+		if err != nil {
+			if broken == nil {
+				broken = err
+			}
+			return nil
+		}
+		groups = append(groups, ico)
+		return nil
+	})
+	if err == nil && len(groups) == 0 {
+		err = broken
+	}
+	return groups, err
+}
+
+// resourceSection returns the section holding the resource directory.
+func resourceSection(f *pe.File) *pe.Section {
+	var dir pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if len(h.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	case *pe.OptionalHeader64:
+		if len(h.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	}
+	for _, s := range f.Sections {
+		if dir.VirtualAddress != 0 && dir.VirtualAddress >= s.VirtualAddress && dir.VirtualAddress < s.VirtualAddress+s.VirtualSize {
+			return s
+		}
+	}
+	return f.Section(".rsrc")
+}
+
+// walk calls fn with the data of the resources of the provided type, in the order
+// of the directory, using the first language of each resource.
+func (r *resources) walk(typ uint32, fn func(id uint32, data []byte) error) error {
+	types, err := r.entries(0)
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		if t.id != typ || !t.dir {
+			continue
+		}
+		names, err := r.entries(t.offset)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			off := n.offset
+			if n.dir {
+				langs, err := r.entries(n.offset)
+				if err != nil {
+					return err
+				}
+				if len(langs) == 0 || langs[0].dir {
+					continue
+				}
+				off = langs[0].offset
+			}
+			data, err := r.leaf(off)
+			if err != nil {
+				return err
+			}
+			if err := fn(n.id, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type entry struct {
+	id     uint32 // identifier, or name offset for named entries
+	dir    bool   // whether offset points to a subdirectory
+	offset uint32
+}
+
+// entries returns the entries of the directory at the provided offset of the section.
+func (r *resources) entries(offset uint32) ([]entry, error) {
+	if int64(offset)+16 > int64(len(r.data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	d := r.data[offset:]
+	count := int(binary.LittleEndian.Uint16(d[12:])) + int(binary.LittleEndian.Uint16(d[14:]))
+	if 16+8*count > len(d) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	res := make([]entry, count)
+	for idx := range res {
+		e := d[16+8*idx:]
+		v := binary.LittleEndian.Uint32(e[4:])
+		res[idx] = entry{
+			id:     binary.LittleEndian.Uint32(e),
+			dir:    v&0x80000000 != 0,
+			offset: v &^ 0x80000000,
+		}
+	}
+	return res, nil
+}
+
+// leaf returns the data described by the data entry at the provided offset of the section.
+func (r *resources) leaf(offset uint32) ([]byte, error) {
+	if int64(offset)+16 > int64(len(r.data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	rva := binary.LittleEndian.Uint32(r.data[offset:])
+	size := binary.LittleEndian.Uint32(r.data[offset+4:])
+	start := int64(rva) - int64(r.rva)
+	if start < 0 || start+int64(size) > int64(len(r.data)) {
+		return nil, fmt.Errorf("resource data at %#x out of the section", rva)
+	}
+	return r.data[start : start+int64(size)], nil
+}
+
+// groupToICO builds an .ico file from a group icon resource and the icons it references.
+func groupToICO(group []byte, icons map[uint32][]byte) ([]byte, error) {
+	if len(group) < 6 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	count := int(binary.LittleEndian.Uint16(group[4:]))
+	if len(group) < 6+14*count {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	hdr := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+	offset := 6 + 16*count
+	hdr.Write(group[:6])
+	for idx := 0; idx < count; idx++ {
+		e := group[6+14*idx:]
+		id := uint32(binary.LittleEndian.Uint16(e[12:]))
+		data, ok := icons[id]
+		if !ok {
+			return nil, fmt.Errorf("missing icon resource %d", id)
+		}
+		hdr.Write(e[:8]) // width, height, colors, reserved, planes, bits
+		binary.Write(hdr, binary.LittleEndian, []uint32{uint32(len(data)), uint32(offset + body.Len())})
+		body.Write(data)
+	}
+	return append(hdr.Bytes(), body.Bytes()...), nil
+}
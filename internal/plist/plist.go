@@ -0,0 +1,191 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plist reads the string values of property list files.
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Strings returns the string values of the top-level dictionary of a property list,
+// in the XML or binary format. Values of other types are ignored.
+func Strings(data []byte) (map[string]string, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return binaryStrings(data)
+	}
+	return xmlStrings(data)
+}
+
+func xmlStrings(data []byte) (map[string]string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	res := make(map[string]string)
+
+	depth := 0 // depth within the top-level dictionary
+	var key string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if t.Name.Local == "dict" {
+					depth = 1
+				}
+				continue
+			}
+			if depth == 1 && (t.Name.Local == "key" || t.Name.Local == "string") {
+				var s string
+				if err := d.DecodeElement(&s, &t); err != nil {
+					return nil, err
+				}
+				if t.Name.Local == "key" {
+					key = s
+				} else {
+					res[key] = s
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			if depth == 1 && t.Name.Local == "dict" {
+				return res, nil
+			}
+			if depth > 1 {
+				depth--
+			}
+		}
+	}
+	if depth == 0 {
+		return nil, fmt.Errorf("no dictionary found")
+	}
+	return res, nil
+}
+
+type binaryList struct {
+	data    []byte
+	offsets []uint64
+	refSize int
+}
+
+func binaryStrings(data []byte) (map[string]string, error) {
+	if len(data) < 8+32 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	trailer := data[len(data)-32:]
+	offSize := int(trailer[6])
+	refSize := int(trailer[7])
+	count := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	table := binary.BigEndian.Uint64(trailer[24:])
+	if offSize < 1 || offSize > 8 || refSize < 1 || refSize > 8 || top >= count ||
+		table > uint64(len(data)) || count > (uint64(len(data))-table)/uint64(offSize) {
+		return nil, fmt.Errorf("invalid binary property list trailer")
+	}
+
+	l := &binaryList{data: data, refSize: refSize, offsets: make([]uint64, count)}
+	for idx := range l.offsets {
+		l.offsets[idx] = readUint(data[table+uint64(idx*offSize):], offSize)
+	}
+
+	marker, n, body, err := l.object(top)
+	if err != nil {
+		return nil, err
+	}
+	if marker != 0xd {
+		return nil, fmt.Errorf("top-level object is not a dictionary")
+	}
+	if n > uint64(len(body))/(2*uint64(refSize)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	res := make(map[string]string)
+	for idx := uint64(0); idx < n; idx++ {
+		k, err := l.str(readUint(body[idx*uint64(refSize):], refSize))
+		if err != nil {
+			return nil, err
+		}
+		v, err := l.str(readUint(body[(n+idx)*uint64(refSize):], refSize))
+		if err != nil {
+			continue // not a string
+		}
+		res[k] = v
+	}
+	return res, nil
+}
+
+// object returns the type marker, the count and the content of an object.
+func (l *binaryList) object(ref uint64) (marker byte, n uint64, body []byte, err error) {
+	if ref >= uint64(len(l.offsets)) || l.offsets[ref] >= uint64(len(l.data)) {
+		return 0, 0, nil, fmt.Errorf("invalid object reference %d", ref)
+	}
+	b := l.data[l.offsets[ref]:]
+	marker, n, body = b[0]>>4, uint64(b[0]&0xf), b[1:]
+	if n == 0xf && marker != 0 && marker != 1 && marker != 2 && marker != 3 {
+		// the count follows as an integer object
+		if len(body) < 1 || body[0]>>4 != 1 {
+			return 0, 0, nil, fmt.Errorf("invalid object count")
+		}
+		size := 1 << (body[0] & 0xf)
+		if len(body) < 1+size {
+			return 0, 0, nil, io.ErrUnexpectedEOF
+		}
+		n = readUint(body[1:], size)
+		body = body[1+size:]
+	}
+	return marker, n, body, nil
+}
+
+func (l *binaryList) str(ref uint64) (string, error) {
+	marker, n, body, err := l.object(ref)
+	if err != nil {
+		return "", err
+	}
+	switch marker {
+	case 0x5: // ASCII
+		if uint64(len(body)) < n {
+			return "", io.ErrUnexpectedEOF
+		}
+		return string(body[:n]), nil
+	case 0x6: // UTF-16
+		if n > uint64(len(body))/2 {
+			return "", io.ErrUnexpectedEOF
+		}
+		u := make([]uint16, n)
+		for idx := range u {
+			u[idx] = binary.BigEndian.Uint16(body[2*idx:])
+		}
+		return string(utf16.Decode(u)), nil
+	}
+	return "", fmt.Errorf("object %d is not a string", ref)
+}
+
+func readUint(b []byte, size int) uint64 {
+	var v uint64
+	for _, c := range b[:size] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
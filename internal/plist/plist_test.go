@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plist
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStrings(t *testing.T) {
+	t.Parallel()
+	icns, err := os.ReadFile("../../testdata/mit.icns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := icns[bytes.Index(icns, []byte("bplist00")):]
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want map[string]string
+	}{
+		{
+			name: "xml",
+			data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIconFile</key>
+	<string>AppIcon</string>
+	<key>LSMinimumSystemVersion</key>
+	<string>10.13</string>
+	<key>CFBundleURLTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleURLName</key>
+			<string>nested</string>
+		</dict>
+	</array>
+	<key>NSHighResolutionCapable</key>
+	<true/>
+	<key>CFBundleName</key>
+	<string>Sample &amp; Co</string>
+</dict>
+</plist>`),
+			want: map[string]string{
+				"CFBundleIconFile":       "AppIcon",
+				"LSMinimumSystemVersion": "10.13",
+				"CFBundleName":           "Sample & Co",
+			},
+		},
+		{
+			name: "binary",
+			data: bin,
+			want: map[string]string{"$archiver": "NSKeyedArchiver"},
+		},
+	} {
+		got, err := Strings(tc.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+
+	// a dictionary whose count overflows the size of its references, with a valid first key
+	overflow := []byte("bplist00" +
+		"\xdf\x13\x80\x00\x00\x00\x00\x00\x00\x00\x01\x01" + // dict of 1<<63 entries
+		"\x51a" + // "a"
+		"\x08\x14" + // offset table
+		"\x00\x00\x00\x00\x00\x00\x01\x01" +
+		"\x00\x00\x00\x00\x00\x00\x00\x02" + // count
+		"\x00\x00\x00\x00\x00\x00\x00\x00" + // top
+		"\x00\x00\x00\x00\x00\x00\x00\x16") // table
+
+	for _, data := range [][]byte{bin[:40], overflow, []byte("<plist></plist>"), []byte("<dict>")} {
+		if _, err := Strings(data); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func FuzzStrings(f *testing.F) {
+	icns, err := os.ReadFile("../../testdata/mit.icns")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(icns[bytes.Index(icns, []byte("bplist00")):])
+	f.Add([]byte("<plist><dict><key>a</key><string>b</string></dict></plist>"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Strings(data) // must not panic
+	})
+}
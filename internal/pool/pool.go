@@ -0,0 +1,98 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pool provides the scratch buffers shared by the codecs, so that converting
+// many icons does not allocate new buffers for every element.
+package pool
+
+import (
+	"bytes"
+	"image/png"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooled is the largest capacity kept for reuse: the channels of a 1024px image.
+const maxPooled = 4 << 20
+
+var (
+	disabled atomic.Bool
+	buffers  = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	slices   sync.Pool // of *[]byte
+	encoders sync.Pool // of *png.EncoderBuffer
+)
+
+// SetEnabled turns pooling on or off. When off, buffers are allocated for each use
+// and released to the garbage collector.
+func SetEnabled(enabled bool) {
+	disabled.Store(!enabled)
+}
+
+// Buffer returns an empty buffer, to be released with PutBuffer.
+func Buffer() *bytes.Buffer {
+	if disabled.Load() {
+		return new(bytes.Buffer)
+	}
+	b := buffers.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// PutBuffer releases a buffer obtained with Buffer. Its content must not be used afterwards.
+func PutBuffer(b *bytes.Buffer) {
+	if disabled.Load() || b.Cap() > maxPooled {
+		return
+	}
+	buffers.Put(b)
+}
+
+// Bytes returns a slice of length n, with unspecified content, to be released with PutBytes.
+func Bytes(n int) []byte {
+	if disabled.Load() {
+		return make([]byte, n)
+	}
+	if p, ok := slices.Get().(*[]byte); ok && cap(*p) >= n {
+		return (*p)[:n]
+	}
+	return make([]byte, n)
+}
+
+// PutBytes releases a slice obtained with Bytes, or grown from one. Its content must
+// not be used afterwards.
+func PutBytes(b []byte) {
+	if disabled.Load() || cap(b) == 0 || cap(b) > maxPooled {
+		return
+	}
+	b = b[:0]
+	slices.Put(&b)
+}
+
+// PNG shares the compression buffers of PNG encoders. It implements png.EncoderBufferPool.
+var PNG png.EncoderBufferPool = pngPool{}
+
+type pngPool struct{}
+
+func (pngPool) Get() *png.EncoderBuffer {
+	if disabled.Load() {
+		return nil
+	}
+	b, _ := encoders.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (pngPool) Put(b *png.EncoderBuffer) {
+	if !disabled.Load() {
+		encoders.Put(b)
+	}
+}
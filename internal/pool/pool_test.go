@@ -0,0 +1,53 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pool
+
+import (
+	"image/png"
+	"testing"
+)
+
+func TestBytes(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		SetEnabled(enabled)
+		for _, n := range []int{0, 10, 1000} {
+			b := Bytes(n)
+			if len(b) != n {
+				t.Errorf("enabled=%v: Bytes(%d) returned %d bytes", enabled, n, len(b))
+			}
+			PutBytes(append(b, 1, 2, 3))
+		}
+
+		buf := Buffer()
+		buf.WriteString("data")
+		PutBuffer(buf)
+		if buf := Buffer(); buf.Len() != 0 {
+			t.Errorf("enabled=%v: Buffer returned %d bytes of content", enabled, buf.Len())
+		}
+	}
+	SetEnabled(true)
+}
+
+func TestPNG(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		SetEnabled(enabled)
+		b := new(png.EncoderBuffer)
+		PNG.Put(b)
+		if got := PNG.Get(); !enabled && got != nil {
+			t.Errorf("enabled=%v: Get returned a pooled buffer", enabled)
+		}
+	}
+	SetEnabled(true)
+}
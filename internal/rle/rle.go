@@ -27,89 +27,112 @@
 // if a longer non-repetitive pattern is seen.
 package rle
 
-import "github.com/kroksys/icns/internal/utils"
+import (
+	"encoding/binary"
+	"fmt"
 
-type byteRec struct {
-	b byte
-	n int
-}
+	"github.com/kroksys/icns/internal/utils"
+)
 
 // Encode RLE-encodes the provided bytes.
 func Encode(b []byte) []byte {
-	var res []byte
-
-	if len(b) == 0 {
-		return res
-	}
-
-	var records []*byteRec
-
-	cur := &byteRec{
-		b: b[0],
-		n: 1,
-	}
-
-	// for simplicity, operate in 2 phases.
-	// Phase 1: don't worry about invididual segment max lengths
-	// and just count successive identical bytes.
-	for i := 1; i < len(b); i++ {
-		c := b[i]
-		if c != cur.b {
-			records = append(records, cur)
-			cur = &byteRec{
-				b: c,
-				n: 1,
-			}
-		} else {
-			cur.n++
-		}
-	}
-	records = append(records, cur)
+	return AppendEncode(nil, b)
+}
 
-	n := 0
-	tmp := make([]byte, 0)
+// AppendEncode appends the RLE encoding of b to dst.
+func AppendEncode(dst, b []byte) []byte {
+	res := dst
 
+	// pending raw bytes, made of runs of 1 or 2 identical bytes
+	rawStart, rawLen := 0, 0
 	flush := func() {
-		if n == 0 {
+		if rawLen == 0 {
 			return
 		}
-		res = append(res, byte(n-1))
-		res = append(res, tmp...)
-		tmp = make([]byte, 0)
-		n = 0
+		res = append(res, byte(rawLen-1))
+		res = append(res, b[rawStart:rawStart+rawLen]...)
+		rawLen = 0
 	}
 
-	// Phase 2: accumulate raw bytes, and flush as soon as a repetition occurs.
-	// Also split sequences to not exceed max counts.
-	for _, r := range records {
-		if r.n < 3 {
-			if n+r.n <= 128 { // so the max segment length is 0x7f
-				n += r.n
-			} else {
-				flush() // the tmp buffer was full
-				n = r.n
-			}
-			for i := 0; i < r.n; i++ {
-				tmp = append(tmp, r.b)
-			}
-		} else {
-			flush() // write the tmp buffer before entering a repetition
-			for r.n > 0 {
+	for i := 0; i < len(b); {
+		n := runLength(b, i)
+		if n >= 3 {
+			flush() // write the raw bytes before entering a repetition
+			for n >= 3 {
 				// because we only compress sequences of 3+ characters
 				// we encode repetitions of 3 to 130 as 0x80 to 0xff
-				n := utils.Min(r.n, 130)
-				res = append(res, byte(0x80+n-3), r.b)
-				r.n -= n
+				m := utils.Min(n, 130)
+				res = append(res, byte(0x80+m-3), b[i])
+				i += m
+				n -= m
+			}
+			if n == 0 {
+				continue
 			}
+			// the 1 or 2 remaining bytes of a long repetition are raw bytes
 		}
+
+		if rawLen+n > 128 { // so the max segment length is 0x7f
+			flush()
+		}
+		if rawLen == 0 {
+			rawStart = i
+		}
+		rawLen += n
+		i += n
 	}
-	flush() // flush whatever we might have left in tmp
+	flush() // flush whatever raw bytes we might have left
 	return res
 }
 
+// runLength returns the number of successive bytes equal to b[i], starting at i.
+func runLength(b []byte, i int) int {
+	c := b[i]
+	j := i + 1
+	// compare 8 bytes at a time first
+	pattern := uint64(c) * 0x0101010101010101
+	for j+8 <= len(b) && binary.LittleEndian.Uint64(b[j:]) == pattern {
+		j += 8
+	}
+	for j < len(b) && b[j] == c {
+		j++
+	}
+	return j - i
+}
+
 // Decode RLE-decodes the provided bytes.
+// Decoding stops at the first truncated segment; use DecodeN to detect malformed data.
 func Decode(p []byte) []byte {
-	var res []byte
+	return AppendDecode(nil, p)
+}
+
+// AppendDecode appends the RLE decoding of p to dst, like Decode.
+func AppendDecode(dst, p []byte) []byte {
+	res, _ := decode(dst, p, -1)
+	return res
+}
+
+// DecodeN RLE-decodes the provided bytes, that must decode to exactly n bytes.
+// It returns an error for truncated segments and for data decoding to a different length.
+func DecodeN(p []byte, n int) ([]byte, error) {
+	return AppendDecodeN(make([]byte, 0, n), p, n)
+}
+
+// AppendDecodeN appends the RLE decoding of p to dst, like DecodeN.
+func AppendDecodeN(dst, p []byte, n int) ([]byte, error) {
+	res, err := decode(dst, p, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(res)-len(dst) != n {
+		return nil, fmt.Errorf("rle: decoded %d bytes, want %d", len(res)-len(dst), n)
+	}
+	return res, nil
+}
+
+// decode appends the RLE decoding of p to dst, failing if the result exceeds max bytes (when max >= 0).
+func decode(dst, p []byte, max int) ([]byte, error) {
+	res := dst
 	pos := 0
 
 	for {
@@ -118,18 +141,32 @@ func Decode(p []byte) []byte {
 		}
 
 		b := p[pos]
+		var n int
+		if b < 0x80 {
+			n = int(b) + 1
+		} else {
+			n = int(b-0x80) + 3
+		}
+		if max >= 0 && len(res)-len(dst)+n > max {
+			return res, fmt.Errorf("rle: segment at offset %d exceeds the expected %d bytes", pos, max)
+		}
+
 		if b < 0x80 {
-			n := int(b) + 1
+			if pos+1+n > len(p) {
+				return res, fmt.Errorf("rle: truncated raw segment at offset %d", pos)
+			}
 			res = append(res, p[pos+1:pos+1+n]...)
 			pos += 1 + n
 		} else {
+			if pos+1 >= len(p) {
+				return res, fmt.Errorf("rle: truncated repeat segment at offset %d", pos)
+			}
 			x := p[pos+1]
-			n := int(b-0x80) + 3
 			for i := 0; i < n; i++ {
 				res = append(res, x)
 			}
 			pos += 2
 		}
 	}
-	return res
+	return res, nil
 }
@@ -146,3 +146,130 @@ func TestUnstableRLE(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeN(t *testing.T) {
+	data := []struct {
+		name    string
+		enc     []byte
+		n       int
+		wantErr bool
+	}{
+		{"exact", []byte{0x02, 0x01, 0x02, 0x02, 0x80, 0x03}, 6, false},
+		{"short output", []byte{0x02, 0x01, 0x02, 0x02}, 6, true},
+		{"long output", []byte{0x02, 0x01, 0x02, 0x02, 0x80, 0x03}, 5, true},
+		{"truncated raw segment", []byte{0x05, 0x01, 0x02}, 6, true},
+		{"truncated repeat segment", []byte{0x02, 0x01, 0x02, 0x02, 0x80}, 6, true},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			decoded, err := rle.DecodeN(tt.enc, tt.n)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DecodeN() = %v, expected an error", decoded)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded) != tt.n {
+				t.Errorf("DecodeN() returned %d bytes, want %d", len(decoded), tt.n)
+			}
+		})
+	}
+}
+
+func TestAppend(t *testing.T) {
+	t.Parallel()
+	dec := []byte{0x01, 0x02, 0x02, 0x03, 0x03, 0x03}
+	enc := []byte{0x02, 0x01, 0x02, 0x02, 0x80, 0x03}
+	prefix := []byte{0xaa, 0xbb}
+
+	got := rle.AppendEncode(append([]byte(nil), prefix...), dec)
+	if diff := cmp.Diff(append(append([]byte(nil), prefix...), enc...), got); diff != "" {
+		t.Errorf("AppendEncode() mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err := rle.AppendDecodeN(append([]byte(nil), prefix...), enc, len(dec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(append(append([]byte(nil), prefix...), dec...), got); diff != "" {
+		t.Errorf("AppendDecodeN() mismatch (-want +got):\n%s", diff)
+	}
+	got = rle.AppendDecode(append([]byte(nil), prefix...), append(enc, 0x05)) // truncated segment
+	if diff := cmp.Diff(append(append([]byte(nil), prefix...), dec...), got); diff != "" {
+		t.Errorf("AppendDecode() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := rle.AppendDecodeN(prefix, enc, len(dec)-1); err == nil {
+		t.Error("AppendDecodeN(): expected an error for a long output")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	// repetitions around the segment limits, mixed with raw bytes
+	for _, n := range []int{1, 2, 3, 129, 130, 131, 132, 133, 259, 260, 261, 262, 1000} {
+		for _, raw := range []int{0, 1, 2, 127, 128} {
+			var dec []byte
+			for i := 0; i < raw; i++ {
+				dec = append(dec, byte(i%2+1))
+			}
+			for i := 0; i < n; i++ {
+				dec = append(dec, 7)
+			}
+			dec = append(dec, 1, 2)
+
+			got, err := rle.DecodeN(rle.Encode(dec), len(dec))
+			if err != nil {
+				t.Fatalf("%d raw bytes then %d repetitions: %v", raw, n, err)
+			}
+			if diff := cmp.Diff(dec, got); diff != "" {
+				t.Errorf("%d raw bytes then %d repetitions: mismatch (-want +got):\n%s", raw, n, diff)
+			}
+		}
+	}
+}
+
+// planes returns 1024px channels of typical content.
+func planes() map[string][]byte {
+	flat := make([]byte, 1024*1024)
+	gradient := make([]byte, 1024*1024)
+	noise := make([]byte, 1024*1024)
+	x := uint32(1)
+	for i := range gradient {
+		gradient[i] = byte(i % 1024 / 4)
+		x = x*1664525 + 1013904223
+		noise[i] = byte(x >> 24)
+	}
+	return map[string][]byte{"flat": flat, "gradient": gradient, "noise": noise}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for name, p := range planes() {
+		p := p
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(p)))
+			var dst []byte
+			for i := 0; i < b.N; i++ {
+				dst = rle.AppendEncode(dst[:0], p)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for name, p := range planes() {
+		enc := rle.Encode(p)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(p)))
+			var dst []byte
+			for i := 0; i < b.N; i++ {
+				dst = rle.AppendDecode(dst[:0], enc)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rsrc reads and writes classic Mac OS resource forks.
+package rsrc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// AppleDouble and AppleSingle files store the resource fork of a file along with its other metadata.
+const (
+	appleSingleMagic = 0x00051600
+	appleDoubleMagic = 0x00051607
+	resourceForkID   = 2
+)
+
+// Resource is an element of a resource fork.
+type Resource struct {
+	Type uint32
+	ID   int16
+	Data []byte
+}
+
+// Fork returns the resource fork stored in an AppleDouble or AppleSingle file,
+// or data itself otherwise.
+func Fork(data []byte) ([]byte, error) {
+	if len(data) < 26 {
+		return data, nil
+	}
+	magic := binary.BigEndian.Uint32(data)
+	if magic != appleSingleMagic && magic != appleDoubleMagic {
+		return data, nil
+	}
+
+	count := int(binary.BigEndian.Uint16(data[24:]))
+	if len(data) < 26+12*count {
+		return nil, io.ErrUnexpectedEOF
+	}
+	for idx := 0; idx < count; idx++ {
+		e := data[26+12*idx:]
+		if binary.BigEndian.Uint32(e) != resourceForkID {
+			continue
+		}
+		off, size := int64(binary.BigEndian.Uint32(e[4:])), int64(binary.BigEndian.Uint32(e[8:]))
+		if off+size > int64(len(data)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return data[off : off+size], nil
+	}
+	return nil, fmt.Errorf("no resource fork")
+}
+
+// Decode returns the resources of a resource fork, in the order of its map.
+func Decode(fork []byte) ([]Resource, error) {
+	be := binary.BigEndian
+	if len(fork) < 16 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	dataOff := int64(be.Uint32(fork))
+	mapOff := int64(be.Uint32(fork[4:]))
+	mapLen := int64(be.Uint32(fork[12:]))
+	if mapOff+mapLen > int64(len(fork)) || mapLen < 30 {
+		return nil, fmt.Errorf("invalid resource map")
+	}
+	m := fork[mapOff : mapOff+mapLen]
+
+	typeList := int(be.Uint16(m[24:]))
+	if typeList+2 > len(m) {
+		return nil, fmt.Errorf("invalid resource type list")
+	}
+	types := int(int16(be.Uint16(m[typeList:]))) + 1
+	if typeList+2+8*types > len(m) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var res []Resource
+	for t := 0; t < types; t++ {
+		e := m[typeList+2+8*t:]
+		typ := be.Uint32(e)
+		count := int(be.Uint16(e[4:])) + 1
+		refs := typeList + int(be.Uint16(e[6:]))
+		if refs+12*count > len(m) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		for r := 0; r < count; r++ {
+			ref := m[refs+12*r:]
+			off := dataOff + int64(be.Uint32(ref[4:])&0xffffff)
+			if off+4 > int64(len(fork)) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			size := int64(be.Uint32(fork[off:]))
+			if off+4+size > int64(len(fork)) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			res = append(res, Resource{
+				Type: typ,
+				ID:   int16(be.Uint16(ref)),
+				Data: fork[off+4 : off+4+size],
+			})
+		}
+	}
+	return res, nil
+}
+
+// Encode builds a resource fork holding the provided resources, without names.
+func Encode(resources []Resource) []byte {
+	be := binary.BigEndian
+
+	var types []uint32
+	byType := make(map[uint32][]int)
+	for idx, r := range resources {
+		if _, ok := byType[r.Type]; !ok {
+			types = append(types, r.Type)
+		}
+		byType[r.Type] = append(byType[r.Type], idx)
+	}
+
+	const hdrSize, mapHdrSize = 256, 28
+	var data []byte
+	offsets := make([]int, len(resources))
+	for idx, r := range resources {
+		offsets[idx] = len(data)
+		data = be.AppendUint32(data, uint32(len(r.Data)))
+		data = append(data, r.Data...)
+	}
+
+	typeListSize := 2 + 8*len(types)
+	m := make([]byte, mapHdrSize, mapHdrSize+typeListSize+12*len(resources))
+	be.PutUint16(m[24:], mapHdrSize)
+	be.PutUint16(m[26:], uint16(cap(m))) // empty name list, at the end of the map
+	m = be.AppendUint16(m, uint16(len(types)-1))
+	refs := typeListSize
+	for _, t := range types {
+		m = be.AppendUint32(m, t)
+		m = be.AppendUint16(m, uint16(len(byType[t])-1))
+		m = be.AppendUint16(m, uint16(refs))
+		refs += 12 * len(byType[t])
+	}
+	for _, t := range types {
+		for _, idx := range byType[t] {
+			m = be.AppendUint16(m, uint16(resources[idx].ID))
+			m = be.AppendUint16(m, 0xffff) // no name
+			m = be.AppendUint32(m, uint32(offsets[idx]))
+			m = be.AppendUint32(m, 0)
+		}
+	}
+
+	hdr := make([]byte, hdrSize)
+	be.PutUint32(hdr, hdrSize)
+	be.PutUint32(hdr[4:], uint32(hdrSize+len(data)))
+	be.PutUint32(hdr[8:], uint32(len(data)))
+	be.PutUint32(hdr[12:], uint32(len(m)))
+	copy(m, hdr[:16])
+
+	return append(append(hdr, data...), m...)
+}
@@ -15,23 +15,115 @@
 package utils
 
 import (
+	"bytes"
 	"image"
+	"image/color"
 	"image/draw"
 )
 
 func Img2NRGBA(img image.Image) *image.NRGBA {
+	return Img2NRGBAInto(nil, img)
+}
+
+// Img2NRGBAInto converts img into dst, which is reallocated if nil or of another size.
+func Img2NRGBAInto(dst *image.NRGBA, img image.Image) *image.NRGBA {
 	r := img.Bounds()
-	res := image.NewNRGBA(r)
-	draw.Draw(res, r, img, image.Point{}, draw.Over)
-	return res
+	if dst == nil || dst.Rect != r {
+		dst = image.NewNRGBA(r)
+	}
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
 }
 
 func NRGBAChannel(img *image.NRGBA, c int) []byte {
-	size := len(img.Pix) / 4
-	res := make([]byte, size)
+	return AppendNRGBAChannel(make([]byte, 0, len(img.Pix)/4), img, c)
+}
+
+// AppendNRGBAChannel appends the values of channel c of img to dst.
+func AppendNRGBAChannel(dst []byte, img *image.NRGBA, c int) []byte {
+	for idx := c; idx < len(img.Pix); idx += 4 {
+		dst = append(dst, img.Pix[idx])
+	}
+	return dst
+}
+
+// CloneImage returns a deep copy of img, keeping its type for the standard image types.
+func CloneImage(img image.Image) image.Image {
+	switch m := img.(type) {
+	case nil:
+		return nil
+	case *image.NRGBA:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.RGBA:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.NRGBA64:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.RGBA64:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.Alpha:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.Gray:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		return &c
+	case *image.Paletted:
+		c := *m
+		c.Pix = append([]uint8(nil), m.Pix...)
+		c.Palette = append(color.Palette(nil), m.Palette...)
+		return &c
+	case *image.YCbCr:
+		c := *m
+		c.Y = append([]uint8(nil), m.Y...)
+		c.Cb = append([]uint8(nil), m.Cb...)
+		c.Cr = append([]uint8(nil), m.Cr...)
+		return &c
+	}
+	return Img2NRGBA(img)
+}
+
+// EqualImages reports whether a and b have the same bounds and pixels.
+func EqualImages(a, b image.Image) bool {
+	r := a.Bounds()
+	if r != b.Bounds() {
+		return false
+	}
+
+	switch ma := a.(type) {
+	case *image.NRGBA:
+		if mb, ok := b.(*image.NRGBA); ok {
+			return equalRows(ma.Pix, mb.Pix, ma.Stride, mb.Stride, r.Dx()*4, r.Dy())
+		}
+	case *image.RGBA:
+		if mb, ok := b.(*image.RGBA); ok {
+			return equalRows(ma.Pix, mb.Pix, ma.Stride, mb.Stride, r.Dx()*4, r.Dy())
+		}
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.NRGBA64Model.Convert(a.At(x, y)) != color.NRGBA64Model.Convert(b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
 
-	for idx := range res {
-		res[idx] = img.Pix[idx*4+c]
+func equalRows(a, b []byte, strideA, strideB, width, height int) bool {
+	for y := 0; y < height; y++ {
+		if !bytes.Equal(a[y*strideA:y*strideA+width], b[y*strideB:y*strideB+width]) {
+			return false
+		}
 	}
-	return res
+	return true
 }
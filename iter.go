@@ -0,0 +1,51 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"iter"
+)
+
+// All returns an iterator over the decoded images of the icon and their formats.
+// Assets without a decoded image are skipped.
+func (i *ICNS) All() iter.Seq2[*Format, image.Image] {
+	return func(yield func(*Format, image.Image) bool) {
+		for _, a := range i.Assets {
+			img, err := a.AsImage()
+			if err != nil || img == nil {
+				continue
+			}
+			if !yield(a.Format, img) {
+				return
+			}
+		}
+	}
+}
+
+// Masks returns an iterator over the masks of the legacy images of the icon,
+// as read from the source file, and their formats.
+func (i *ICNS) Masks() iter.Seq2[*Format, image.Image] {
+	return func(yield func(*Format, image.Image) bool) {
+		for _, a := range i.Assets {
+			if a.mask == nil {
+				continue
+			}
+			if !yield(supportedMaskFormats[a.Format.CombineCode], a.mask) {
+				return
+			}
+		}
+	}
+}
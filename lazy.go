@@ -0,0 +1,141 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+
+	"github.com/kroksys/icns/codec"
+	"github.com/kroksys/icns/internal/binary"
+)
+
+// WithLazyDecoding defers the decoding of images until their pixels are first accessed,
+// which saves time and memory when only some of them are used. Images are then reported
+// at the resolution of their format: codec errors and size mismatches are returned by
+// Img.AsImage, and the affected images read as transparent.
+func WithLazyDecoding() DecodeOption {
+	return func(o *decodeOptions) {
+		o.lazy = true
+	}
+}
+
+// AsImage returns the decoded image, decoding it first if it was loaded with
+// WithLazyDecoding. Decoding happens once, and the result is shared by later calls.
+func (a *Img) AsImage() (image.Image, error) {
+	l, ok := a.Image.(*lazyImage)
+	if !ok {
+		if a.Image == nil {
+			return nil, ErrNoImage
+		}
+		return a.Image, nil
+	}
+	l.load()
+	if l.err != nil {
+		return nil, &ChunkError{Code: l.format.Code, Offset: l.offset, Err: l.err}
+	}
+	return l.img, nil
+}
+
+// lazyImage decodes the data of an element on first access.
+type lazyImage struct {
+	format *Format
+	dec    codec.Codec
+	offset int
+	data   []byte
+	mask   image.Image // composited with the decoded image, if set
+	keep   bool        // keep images whose size differs from the format
+
+	once sync.Once
+	img  image.Image
+	err  error
+}
+
+func (l *lazyImage) load() {
+	l.once.Do(func() {
+		r := binary.Reader(l.data)
+		img, _, err := l.dec.Decode(&r, l.format.Res)
+		if err != nil {
+			l.err = err
+			return
+		}
+		res := int(l.format.Res)
+		if b := img.Bounds(); !l.keep && (b.Dx() != res || b.Dy() != res) {
+			l.err = fmt.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), res, res)
+			return
+		}
+		if l.mask != nil {
+			img = composite(img, l.mask, l.format.Res)
+		}
+		l.img = img
+	})
+}
+
+func (l *lazyImage) ColorModel() color.Model {
+	if l.load(); l.img == nil {
+		return color.NRGBAModel
+	}
+	return l.img.ColorModel()
+}
+
+func (l *lazyImage) Bounds() image.Rectangle {
+	if !l.keep {
+		return image.Rect(0, 0, int(l.format.Res), int(l.format.Res))
+	}
+	if l.load(); l.img == nil {
+		return image.Rectangle{}
+	}
+	return l.img.Bounds()
+}
+
+func (l *lazyImage) At(x, y int) color.Color {
+	if l.load(); l.img == nil {
+		return color.Transparent
+	}
+	return l.img.At(x, y)
+}
+
+// decoded returns the decoded image behind img, if it is lazily decoded.
+func decoded(img image.Image) image.Image {
+	if l, ok := img.(*lazyImage); ok {
+		if l.load(); l.img != nil {
+			return l.img
+		}
+	}
+	return img
+}
+
+// sniffEncoder returns the name of the encoding of data, as reported by the
+// built-in codecs once decoded.
+func sniffEncoder(f *Format, data []byte) string {
+	switch f.decoderFor(data) {
+	case codec.ImageCodec, codec.JPEGCodec:
+		if dataEncoding("", data) == EncodingJP2 {
+			return "jp2"
+		}
+		if bytes.HasPrefix(data, jpegHeader) {
+			return "jpeg"
+		}
+		return "png"
+	case codec.ARGBCodec:
+		return "argb"
+	case codec.PackCodec, codec.It32Codec:
+		return "icon"
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestWithLazyDecoding(t *testing.T) {
+	t.Parallel()
+	want, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Decode(testdataFileReader(t, "mit.icns"), WithLazyDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := i.Info(), want.Info(); got != want {
+		t.Errorf("unexpected icon:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, a := range i.Assets {
+		l, ok := a.Image.(*lazyImage)
+		if !ok {
+			t.Fatalf("[%s] image decoded eagerly", CodeString(a.Format.Code))
+		}
+		if l.img != nil {
+			t.Errorf("[%s] image decoded before access", CodeString(a.Format.Code))
+		}
+	}
+
+	for _, a := range want.Assets {
+		got, err := i.ByCode(a.Format.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := got.AsImage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := img.(*lazyImage); ok {
+			t.Errorf("[%s] AsImage returned the lazy image", CodeString(a.Format.Code))
+		}
+		if !utils.EqualImages(img, a.Image) {
+			t.Errorf("[%s] unexpected image", CodeString(a.Format.Code))
+		}
+	}
+
+	wbuf, gbuf := new(bytes.Buffer), new(bytes.Buffer)
+	if err := Encode(wbuf, want, WithJPEGQuality(90)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(gbuf, i, WithJPEGQuality(90)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gbuf.Bytes(), wbuf.Bytes()) {
+		t.Error("lazily decoded icon encoded differently")
+	}
+}
+
+func TestWithLazyDecodingErrors(t *testing.T) {
+	t.Parallel()
+	b := rawICNS(t, Chunk{Code: CodeIc07, Data: []byte("\x89PNG\r\n\x1a\nbroken")})
+
+	if _, err := Decode(bytes.NewReader(b), WithStrictDecoding()); err == nil {
+		t.Fatal("expected an error for broken data")
+	}
+	i, err := Decode(bytes.NewReader(b), WithLazyDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != 1 {
+		t.Fatalf("got %d images, want 1", len(i.Assets))
+	}
+	a := i.Assets[0]
+	if b := a.Image.Bounds(); b != image.Rect(0, 0, 128, 128) {
+		t.Errorf("got bounds %v", b)
+	}
+	if _, err := a.AsImage(); err == nil {
+		t.Error("expected an error for broken data")
+	} else {
+		var cerr *ChunkError
+		if !errors.As(err, &cerr) || cerr.Code != CodeIc07 || cerr.Offset != 8 {
+			t.Errorf("got %v, want a *ChunkError for ic07 at offset 8", err)
+		}
+	}
+	if _, err := i.ByResolution(Pixel128); err == nil {
+		t.Error("ByResolution: expected an error for broken data")
+	}
+}
+
+func TestDataEncoding(t *testing.T) {
+	t.Parallel()
+	for _, opts := range [][]DecodeOption{nil, {WithLazyDecoding()}} {
+		i, err := Decode(testdataFileReader(t, "mit.icns"), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range i.Assets {
+			if got := a.DataEncoding(); got == EncodingAuto || got.String() != strings.Replace(a.Encoder, "icon", "rle", 1) {
+				t.Errorf("[%s] got encoding %s, want %s", CodeString(a.Format.Code), got, a.Encoder)
+			}
+		}
+	}
+
+	jp2 := append([]byte("\x00\x00\x00\x0cjP  \r\n\x87\n"), make([]byte, 16)...)
+	i, err := Decode(bytes.NewReader(rawICNS(t, Chunk{Code: CodeIc09, Data: jp2})), WithLazyDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != 1 || i.Assets[0].DataEncoding() != EncodingJP2 {
+		t.Errorf("JPEG 2000 data not reported as such")
+	}
+}
+
+func TestAsImageNil(t *testing.T) {
+	t.Parallel()
+	a := &Img{Format: supportedImageFormats[CodeIc07]}
+	if img, err := a.AsImage(); img != nil || !errors.Is(err, ErrNoImage) {
+		t.Errorf("got %v, %v, want ErrNoImage", img, err)
+	}
+}
+
+func TestMissingImages(t *testing.T) {
+	t.Parallel()
+	// an asset without image, and one whose data cannot be decoded
+	data := rawICNS(t, Chunk{Code: CodeIc08, Data: []byte("not an image")})
+	i, err := Decode(bytes.NewReader(data), WithLazyDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.Assets = append(i.Assets, &Img{Format: supportedImageFormats[CodeIc07]})
+
+	if info := i.Info(); !strings.Contains(info, "resolution 128") {
+		t.Errorf("unexpected info:\n%s", info)
+	}
+	if err := i.ApplyBadge(image.NewNRGBA(image.Rect(0, 0, 8, 8)), AnchorCenter, 0.5); err != nil {
+		t.Errorf("ApplyBadge: %v", err)
+	}
+	i.DeriveDark(InvertLuminance)
+	if err := i.EncodeICO(new(bytes.Buffer), 32); err == nil {
+		t.Error("EncodeICO: expected an error without any image to scale")
+	}
+	if _, err := i.sizedPNG(32); err == nil {
+		t.Error("sizedPNG: expected an error without any image to scale")
+	}
+	if err := i.FillMissing(); err == nil {
+		t.Error("FillMissing: expected an error without any image to scale")
+	}
+
+	// a valid image is used instead of the broken ones
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 512, 512))); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.EncodeICO(new(bytes.Buffer), 32); err != nil {
+		t.Errorf("EncodeICO: %v", err)
+	}
+	if _, err := i.sizedPNG(32); err != nil {
+		t.Errorf("sizedPNG: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// Limits bounds the resources used by Decode, for instance when handling untrusted files.
+// Zero values mean no limit.
+type Limits struct {
+	MaxFileSize  int64 // size of the whole file, in bytes
+	MaxChunkSize int   // size of a single element, in bytes
+	MaxPixels    int64 // total number of decoded pixels, across all images and masks
+	MaxAssets    int   // number of decoded images
+}
+
+// WithLimits makes Decode fail with a *LimitError as soon as one of the limits is exceeded.
+// Limits are checked before decompressing any data.
+func WithLimits(l Limits) DecodeOption {
+	return func(o *decodeOptions) {
+		o.limits = l
+	}
+}
+
+// LimitError reports a file exceeding the limits set with WithLimits.
+type LimitError struct {
+	Limit  string // name of the exceeded Limits field
+	Code   uint32 // code of the element exceeding the limit, if any
+	Offset int    // offset of the element header in the file
+	Value  int64
+	Max    int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("%s exceeded: %d > %d", e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%s exceeded by %s at offset %d: %d > %d", e.Limit, CodeString(e.Code), e.Offset, e.Value, e.Max)
+}
+
+// limiter keeps track of the resources used while decoding a file.
+type limiter struct {
+	Limits
+	pixels int64
+	assets int
+}
+
+func (l *limiter) chunk(code uint32, offset, size int) error {
+	if l.MaxChunkSize > 0 && size > l.MaxChunkSize {
+		return &LimitError{Limit: "MaxChunkSize", Code: code, Offset: offset, Value: int64(size), Max: int64(l.MaxChunkSize)}
+	}
+	return nil
+}
+
+// decode accounts for the decoding of data in format f, using the dimensions
+// announced by the data itself when available.
+func (l *limiter) decode(f *Format, offset int, data []byte) error {
+	if l.MaxAssets > 0 && supportedMaskFormats[f.Code] == nil {
+		l.assets++
+		if l.assets > l.MaxAssets {
+			return &LimitError{Limit: "MaxAssets", Code: f.Code, Offset: offset, Value: int64(l.assets), Max: int64(l.MaxAssets)}
+		}
+	}
+
+	if l.MaxPixels > 0 {
+		pixels := int64(f.Res) * int64(f.Res)
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			pixels = int64(cfg.Width) * int64(cfg.Height)
+		}
+		l.pixels += pixels
+		if l.pixels > l.MaxPixels {
+			return &LimitError{Limit: "MaxPixels", Code: f.Code, Offset: offset, Value: l.pixels, Max: l.MaxPixels}
+		}
+	}
+	return nil
+}
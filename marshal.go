@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"io"
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler. It returns the .icns file of the
+// icon, keeping the elements this package does not support.
+func (i *ICNS) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithPreserveUnknownChunks()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the icon with
+// the one decoded from the .icns file in data, including its settings.
+func (i *ICNS) UnmarshalBinary(data []byte) error {
+	// the decoded images keep referencing their original data
+	d, err := readICNS(append([]byte(nil), data...), decodeOptions{})
+	if err != nil {
+		return err
+	}
+	*i = *d
+	return nil
+}
+
+// WriteTo implements io.WriterTo, writing the icon as Encode does with default options.
+// When w is an io.WriteSeeker, elements are written as they are encoded, without building
+// the file in memory; otherwise, they are all encoded before writing the file header,
+// which holds the size of the file.
+func (i *ICNS) WriteTo(w io.Writer) (int64, error) {
+	if ws, ok := w.(io.WriteSeeker); ok {
+		start, err := ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		sw := &seekCounter{WriteSeeker: ws, pos: start, end: start}
+		err = Encode(sw, i)
+		return sw.end - start, err
+	}
+	cw := &countWriter{Writer: w}
+	err := Encode(cw, i)
+	return cw.n, err
+}
+
+// countWriter counts the bytes written to a writer.
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// seekCounter tracks the furthest offset written to a writer.
+type seekCounter struct {
+	io.WriteSeeker
+	pos, end int64
+}
+
+func (w *seekCounter) Write(p []byte) (int, error) {
+	n, err := w.WriteSeeker.Write(p)
+	w.pos += int64(n)
+	if w.pos > w.end {
+		w.end = w.pos
+	}
+	return n, err
+}
+
+func (w *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	pos, err := w.WriteSeeker.Seek(offset, whence)
+	if err == nil {
+		w.pos = pos
+	}
+	return pos, err
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := i.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithPreserveUnknownChunks()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(buf.Bytes(), data); diff != "" {
+		t.Errorf("unexpected data (-want +got):\n%s", diff)
+	}
+
+	var got ICNS
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.unsupported) != len(i.unsupported) {
+		t.Errorf("got %d unsupported chunks, want %d", len(got.unsupported), len(i.unsupported))
+	}
+	again, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Error("icon not preserved by a round trip")
+	}
+
+	if err := got.UnmarshalBinary([]byte("nope")); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+}
+
+func TestGob(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(i); err != nil {
+		t.Fatal(err)
+	}
+	var got *ICNS
+	if err := gob.NewDecoder(buf).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want, err := i.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Error("icon not preserved through gob")
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(bytes.Buffer)
+	if err := Encode(want, i); err != nil {
+		t.Fatal(err)
+	}
+
+	var _ io.WriterTo = i
+	buf := new(bytes.Buffer)
+	n, err := i.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(want.Len()) || !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("wrote %d bytes, want %d", n, want.Len())
+	}
+
+	ws := &seekBuffer{data: []byte("prefix"), off: 6}
+	n, err = i.WriteTo(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(want.Len()) || !bytes.Equal(ws.data[6:], want.Bytes()) {
+		t.Errorf("seekable writer: wrote %d bytes, want %d", n, want.Len())
+	}
+}
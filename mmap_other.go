@@ -12,16 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package codec
+//go:build !unix
+
+package icns
 
 import (
-	"image"
-	"io"
+	"errors"
+	"os"
 )
 
-type Resolution uint
-
-type Codec interface {
-	Encode(io.Writer, image.Image) error
-	Decode(io.Reader, Resolution) (image.Image, string, error)
+// mmap is not supported on this platform: Open reads the file instead.
+func mmap(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory mapping not supported")
 }
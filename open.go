@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"io"
+	"os"
+)
+
+// File is an icon opened with Open. Its elements reference the content of the file
+// directly, so the icon must not be used after Close.
+type File struct {
+	*ICNS
+	unmap func() error
+}
+
+// Open loads the .icns file at path. Where supported, the file is memory-mapped
+// rather than read, so that only the parts of the file that are accessed use memory;
+// the file must not be modified while it is open. Images are decoded when first accessed,
+// as with WithLazyDecoding.
+func Open(path string, opts ...DecodeOption) (*File, error) {
+	o := decodeOptions{lazy: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if max := o.limits.MaxFileSize; max > 0 && st.Size() > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: st.Size(), Max: max}
+	}
+
+	data, unmap, err := mmap(f, st.Size())
+	if err != nil {
+		// fall back to reading the file
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if data, err = readAll(f, o); err != nil {
+			return nil, err
+		}
+		unmap = func() error { return nil }
+	}
+
+	i, err := readICNS(data, o)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return &File{ICNS: i, unmap: unmap}, nil
+}
+
+// Close releases the content of the file.
+func (f *File) Close() error {
+	if f.unmap == nil {
+		return os.ErrClosed
+	}
+	err := f.unmap()
+	f.unmap = nil
+	f.ICNS = nil
+	return err
+}
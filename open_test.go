@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	want, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(filepath.Join("testdata", "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Info(), f.Info()); diff != "" {
+		t.Errorf("unexpected icon (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.RawChunks(), f.RawChunks()); diff != "" {
+		t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+	}
+	if err := f.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second Close: got %v, want %v", err, os.ErrClosed)
+	}
+
+	// an empty file cannot be mapped, and is reported as invalid
+	empty := filepath.Join(t.TempDir(), "empty.icns")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(empty); err == nil {
+		t.Error("expected an error for an empty file")
+	}
+
+	if _, err := Open(filepath.Join("testdata", "mit.icns"), WithLimits(Limits{MaxFileSize: 100})); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+	if _, err := Open(filepath.Join("testdata", "missing.icns")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestOpenLazy(t *testing.T) {
+	t.Parallel()
+	f, err := Open(filepath.Join("testdata", "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	decoded := func() (n int) {
+		for _, a := range f.Assets {
+			if l, ok := a.Image.(*lazyImage); !ok || l.img != nil {
+				n++
+			}
+		}
+		return n
+	}
+	if n := decoded(); n != 0 {
+		t.Fatalf("got %d images decoded by Open, want 0", n)
+	}
+	if _, err := f.Assets[0].AsImage(); err != nil {
+		t.Fatal(err)
+	}
+	if n := decoded(); n != 1 {
+		t.Errorf("got %d images decoded after accessing one, want 1", n)
+	}
+}
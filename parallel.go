@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"runtime"
+	"sync"
+)
+
+// WithDecodeParallelism makes Decode decode up to n images concurrently, which shortens
+// the decoding of icons made of many large images. The result does not depend on n.
+// A value of 0 or less uses runtime.GOMAXPROCS. By default, images are decoded one at a time.
+// Codecs registered with RegisterFormat must then be safe for concurrent use.
+func WithDecodeParallelism(n int) DecodeOption {
+	return func(o *decodeOptions) {
+		o.parallelism = workers(n)
+	}
+}
+
+// WithParallelism makes Encode compress up to n images concurrently, which shortens
+// the encoding of icons made of many large images. The output does not depend on n.
+// A value of 0 or less uses runtime.GOMAXPROCS. By default, images are encoded one at a time.
+// Codecs registered with RegisterFormat must then be safe for concurrent use.
+func WithParallelism(n int) EncodeOption {
+	return func(o *encodeOptions) {
+		o.parallelism = workers(n)
+	}
+}
+
+// workers returns the number of goroutines to use for the provided setting.
+func workers(n int) int {
+	if n <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return n
+}
+
+// parallel calls fn for each index below count, from at most n goroutines at a time.
+func parallel(n, count int, fn func(k int)) {
+	if n > count {
+		n = count
+	}
+	if n <= 1 {
+		for k := 0; k < count; k++ {
+			fn(k)
+		}
+		return
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				fn(k)
+			}
+		}()
+	}
+	for k := 0; k < count; k++ {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+}
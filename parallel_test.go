@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestParallel(t *testing.T) {
+	t.Parallel()
+	for _, n := range []int{1, 3, 100} {
+		var calls int32
+		seen := make([]int32, 10)
+		parallel(n, len(seen), func(k int) {
+			atomic.AddInt32(&calls, 1)
+			atomic.AddInt32(&seen[k], 1)
+		})
+		if calls != int32(len(seen)) {
+			t.Errorf("n=%d: got %d calls, want %d", n, calls, len(seen))
+		}
+		for k, c := range seen {
+			if c != 1 {
+				t.Errorf("n=%d: index %d seen %d times", n, k, c)
+			}
+		}
+	}
+}
+
+func TestWithDecodeParallelism(t *testing.T) {
+	t.Parallel()
+	want, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 2, 8} {
+		got, err := Decode(testdataFileReader(t, "mit.icns"), WithDecodeParallelism(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want.Info(), got.Info()); diff != "" {
+			t.Errorf("n=%d: unexpected icon (-want +got):\n%s", n, diff)
+		}
+		for k, a := range want.Assets {
+			if !utils.EqualImages(a.Image, got.Assets[k].Image) {
+				t.Errorf("n=%d: [%s] unexpected image", n, CodeString(a.Format.Code))
+			}
+		}
+	}
+
+	// limits are still enforced in file order
+	_, err = Decode(testdataFileReader(t, "mit.icns"), WithDecodeParallelism(4), WithLimits(Limits{MaxAssets: 2}))
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != "MaxAssets" {
+		t.Errorf("got %v, want a MaxAssets *LimitError", err)
+	}
+	_, serr := Decode(testdataFileReader(t, "mit.icns"), WithLimits(Limits{MaxAssets: 2}))
+	if err == nil || serr == nil || err.Error() != serr.Error() {
+		t.Errorf("got %v, want %v", err, serr)
+	}
+
+	broken := rawICNS(t, Chunk{Code: CodeIc07, Data: []byte("broken")})
+	if _, err := Decode(bytes.NewReader(broken), WithDecodeParallelism(4), WithStrictDecoding()); err == nil {
+		t.Error("expected an error for broken data")
+	}
+}
+
+func TestWithParallelism(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Add(utils.CloneImage(i.Assets[0].Image)); err != nil { // forces re-encoding one image
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]EncodeOption{
+		{WithPNGCompression(png.BestSpeed)},
+		{WithPNGCompression(png.BestSpeed), WithDeduplication()},
+		{WithJPEGQuality(80), WithTOC()},
+	} {
+		want := new(bytes.Buffer)
+		if err := Encode(want, i, opts...); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{0, 2, 8} {
+			got := new(bytes.Buffer)
+			if err := Encode(got, i, append(opts, WithParallelism(n))...); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("n=%d: output differs from sequential encoding", n)
+			}
+		}
+	}
+
+	bad := NewICNS()
+	bad.Assets = append(bad.Assets, &Img{
+		Image:    image.NewNRGBA(image.Rect(0, 0, 128, 128)),
+		Format:   supportedImageFormats[CodeIc07],
+		Encoding: EncodingRLE,
+	})
+	if err := Encode(new(bytes.Buffer), bad, WithParallelism(4)); err == nil {
+		t.Error("expected an error for an unsupported encoding")
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import "github.com/kroksys/icns/internal/pool"
+
+// SetBufferPooling sets whether the codecs reuse their scratch buffers across
+// operations, which is the default. Turning pooling off releases the buffers to the
+// garbage collector after each use, for programs that favor a small memory footprint
+// over conversion speed. It is safe for concurrent use.
+func SetBufferPooling(enabled bool) {
+	pool.SetEnabled(enabled)
+}
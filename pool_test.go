@@ -0,0 +1,45 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSetBufferPooling(t *testing.T) {
+	want, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer SetBufferPooling(true)
+	for _, enabled := range []bool{false, true} {
+		SetBufferPooling(enabled)
+		i, err := Decode(bytes.NewReader(want), WithStrictDecoding())
+		if err != nil {
+			t.Fatalf("pooling %v: %v", enabled, err)
+		}
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i, WithPNGCompression(png.BestSpeed), WithPreserveUnknownChunks()); err != nil {
+			t.Fatalf("pooling %v: %v", enabled, err)
+		}
+		if _, err := Decode(buf, WithStrictDecoding()); err != nil {
+			t.Errorf("pooling %v: %v", enabled, err)
+		}
+	}
+}
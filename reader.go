@@ -15,122 +15,626 @@
 package icns
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/draw"
 	"io"
 	"io/ioutil"
 
+	"github.com/kroksys/icns/codec"
 	"github.com/kroksys/icns/internal/binary"
 )
 
-func readICNS(r binary.Reader, metaOnly bool) (*ICNS, error) {
-	hdr := r.Uint32()
+// DecodeOption is the type for Decode options.
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	strict     bool
+	diag       *Diagnostics
+	limits     Limits
+	dimensions DimensionPolicy
+	duplicates DuplicatePolicy
+	noComposit bool
+	lazy       bool
+	streaming  bool
+	images     codec.Codec // replaces codec.ImageCodec, if set
+	dark       bool        // decoding a dark icon, which cannot nest another one
+
+	parallelism int
+}
+
+// WithStrictDecoding makes Decode fail with a *ChunkError on the first element
+// that cannot be decoded, instead of skipping it.
+func WithStrictDecoding() DecodeOption {
+	return func(o *decodeOptions) {
+		o.strict = true
+	}
+}
+
+// DimensionPolicy controls how Decode handles images whose size differs from
+// the resolution of their format.
+type DimensionPolicy int
+
+const (
+	// DimensionsSkip drops mismatched images. This is the default.
+	DimensionsSkip DimensionPolicy = iota
+	// DimensionsReject makes Decode fail with a *ChunkError.
+	DimensionsReject
+	// DimensionsKeep keeps mismatched images under their declared format.
+	DimensionsKeep
+)
+
+// WithDimensionPolicy sets how images whose size differs from the resolution of
+// their format are handled. Mismatches are reported as diagnostics unless rejected.
+// In strict mode, DimensionsSkip behaves as DimensionsReject.
+func WithDimensionPolicy(p DimensionPolicy) DecodeOption {
+	return func(o *decodeOptions) {
+		o.dimensions = p
+	}
+}
+
+// DuplicatePolicy controls how Decode handles a code present several times in a file.
+type DuplicatePolicy int
+
+const (
+	// DuplicateKeepFirst keeps the first element with a given code. This is the default.
+	DuplicateKeepFirst DuplicatePolicy = iota
+	// DuplicateKeepLast keeps the last element with a given code.
+	DuplicateKeepLast
+	// DuplicateError makes Decode fail with a *ChunkError.
+	DuplicateError
+)
+
+// WithDuplicatePolicy sets how images and masks present several times in a file are handled.
+// Ignored duplicates are reported as diagnostics.
+func WithDuplicatePolicy(p DuplicatePolicy) DecodeOption {
+	return func(o *decodeOptions) {
+		o.duplicates = p
+	}
+}
+
+// WithoutMaskCompositing keeps legacy images as stored, without applying their masks.
+// The masks remain available through MaskByResolution, and are written back by Encode.
+func WithoutMaskCompositing() DecodeOption {
+	return func(o *decodeOptions) {
+		o.noComposit = true
+	}
+}
+
+// ChunkError reports an element of a file that could not be decoded.
+type ChunkError struct {
+	Code   uint32
+	Offset int // offset of the element header in the file
+	Err    error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("cannot decode %s at offset %d: %v", CodeString(e.Code), e.Offset, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// ChunkSizeError reports an element whose size field is inconsistent with the file.
+type ChunkSizeError struct {
+	Code      uint32
+	Offset    int // offset of the element header in the file
+	Declared  int // size field of the element, including its header
+	Available int // bytes available from the element header to the end of the file
+}
+
+func (e *ChunkSizeError) Error() string {
+	return fmt.Sprintf("invalid size for %s at offset %d: declared %d bytes, %d available",
+		CodeString(e.Code), e.Offset, e.Declared, e.Available)
+}
+
+func readICNS(r binary.Reader, o decodeOptions) (*ICNS, error) {
+	return readElements(r, o, &limiter{Limits: o.limits})
+}
+
+// readElements decodes an icon file, accounting for its elements in lim, which
+// is shared with the icon nesting it, if any.
+func readElements(r binary.Reader, o decodeOptions, lim *limiter) (*ICNS, error) {
+	total := len(r)
+
+	hdr, err := r.Uint32()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read ICNS header: %w", err)
+	}
 	if hdr != magic {
 		return nil, fmt.Errorf("wrong magic number for ICNS file: %x", hdr)
 	}
 
-	_ = r.Uint32() // size
+	if _, err := r.Uint32(); err != nil { // size
+		return nil, fmt.Errorf("cannot read ICNS header: %w", err)
+	}
+
+	// First pass: split the file into its elements.
+	var chunks []Chunk
+	var offsets []int
+	for {
+		if len(r) == 0 {
+			break
+		}
+
+		offset := total - len(r)
+		available := len(r)
+		code, err := r.Uint32()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read element header at offset %d: %w", offset, err)
+		}
+		size32, err := r.Uint32()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s header at offset %d: %w", CodeString(code), offset, err)
+		}
+		size := int(size32)
+		if size < 8 || size > available {
+			return nil, &ChunkSizeError{
+				Code:      code,
+				Offset:    offset,
+				Declared:  size,
+				Available: available,
+			}
+		}
+		if err := lim.chunk(code, offset, size); err != nil {
+			return nil, err
+		}
+		sub, err := r.Section(size - 8) // size value includes both uint32 for code and size
+		if err != nil {
+			return nil, &ChunkError{Code: code, Offset: offset, Err: err}
+		}
+
+		offsets = append(offsets, offset)
+		chunks = append(chunks, Chunk{
+			Code: code,
+			Data: *sub,
+		})
+	}
+
+	return decodeChunks(chunks, offsets, o, lim)
+}
 
+// decodeChunks builds an icon from its elements, found at the given offsets of the file.
+func decodeChunks(chunks []Chunk, offsets []int, o decodeOptions, lim *limiter) (*ICNS, error) {
 	minCompat := Newest
 	maxCompat := Oldest
+	updateCompat := func(f *Format) {
+		if f.Compat < minCompat {
+			minCompat = f.Compat
+		}
 
-	var assets []*Img
+		if f.Compat > maxCompat {
+			maxCompat = f.Compat
+		}
+	}
+
+	// Select the elements to decode among the duplicated ones.
+	selected := make(map[uint32]int)
+	for idx, c := range chunks {
+		if supportedImageFormats[c.Code] == nil && supportedMaskFormats[c.Code] == nil {
+			continue
+		}
+
+		prev, ok := selected[c.Code]
+		if !ok {
+			selected[c.Code] = idx
+			continue
+		}
+
+		err := fmt.Errorf("duplicate element, also found at offset %d", offsets[prev])
+		switch o.duplicates {
+		case DuplicateError:
+			return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+		case DuplicateKeepLast:
+			o.diag.add(DiagnosticSkipped, c.Code, offsets[prev], fmt.Errorf("duplicate element, also found at offset %d", offsets[idx]))
+			selected[c.Code] = idx
+		default:
+			o.diag.add(DiagnosticSkipped, c.Code, offsets[idx], err)
+		}
+	}
+
+	// Second pass: decode the masks, so that they are available
+	// whatever the order of the legacy images and their masks.
 	masks := make(map[uint32]image.Image)
+	maskOffsets := make(map[uint32]int)
+	for idx, c := range chunks {
+		f, ok := supportedMaskFormats[c.Code]
+		if !ok || selected[c.Code] != idx {
+			continue
+		}
 
-	var unsupportedCodes []uint32
-	for {
-		if len(r) == 0 {
-			break
+		if err := lim.decode(f, offsets[idx], c.Data); err != nil {
+			return nil, err
+		}
+		sub := binary.Reader(c.Data)
+		i, _, err := f.Codec.Decode(&sub, f.Res)
+		if err != nil {
+			if o.strict {
+				return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+			}
+			o.diag.add(DiagnosticCodecError, c.Code, offsets[idx], err)
+			continue
 		}
 
-		code := r.Uint32()
-		size := int(r.Uint32())
-		sub := r.Section(size - 8) // size value includes both uint32 for code and size
+		updateCompat(f)
+		masks[c.Code] = i
+		maskOffsets[c.Code] = offsets[idx]
+	}
 
-		if f, ok := supportedMaskFormats[code]; ok {
-			if metaOnly {
+	// Decode the images concurrently ahead of the third pass, if requested.
+	// The limits are still checked in file order, before decoding anything.
+	var pre []decodedImage
+	limitIdx := -1
+	var limitErr error
+	if o.parallelism > 1 && !o.lazy {
+		pre = make([]decodedImage, len(chunks))
+		var jobs []int
+		for idx, c := range chunks {
+			f, ok := supportedImageFormats[c.Code]
+			if !ok || selected[c.Code] != idx {
 				continue
 			}
+			if err := lim.decode(f, offsets[idx], c.Data); err != nil {
+				limitIdx, limitErr = idx, err
+				break
+			}
+			jobs = append(jobs, idx)
+		}
+		parallel(o.parallelism, len(jobs), func(k int) {
+			idx := jobs[k]
+			f := supportedImageFormats[chunks[idx].Code]
+			pre[idx] = o.decodeImage(f, chunks[idx].Data)
+		})
+	}
+
+	// Third pass: decode the images, and combine them with their masks.
+	var assets []*Img
+	var unsupported []Chunk
+	var dark *ICNS
+	var darkOffset int
+	usedMasks := make(map[uint32]bool)
+	for idx, c := range chunks {
+		if _, ok := supportedMaskFormats[c.Code]; ok || c.Code == CodeTOC {
+			continue
+		}
 
-			i, _, err := f.Codec.Decode(sub, f.Res)
+		if c.Code == CodeDark {
+			if dark != nil {
+				err := fmt.Errorf("duplicate element, also found at offset %d", darkOffset)
+				if o.duplicates == DuplicateError {
+					return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+				}
+				o.diag.add(DiagnosticSkipped, c.Code, offsets[idx], err)
+				continue
+			}
+			if o.dark {
+				err := errors.New("dark icon nested in a dark icon")
+				if o.strict {
+					return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+				}
+				o.diag.add(DiagnosticSkipped, c.Code, offsets[idx], err)
+				continue
+			}
+			nested := o
+			nested.dark = true
+			d, err := readElements(c.Data, nested, lim)
+			var lerr *LimitError
+			if errors.As(err, &lerr) {
+				return nil, err
+			}
 			if err != nil {
+				if o.strict {
+					return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+				}
+				o.diag.add(DiagnosticCodecError, c.Code, offsets[idx], err)
 				continue
 			}
+			dark, darkOffset = d, offsets[idx]
+			continue
+		}
 
-			if f.Compat < minCompat {
-				minCompat = f.Compat
-			}
+		f, ok := supportedImageFormats[c.Code]
+		if !ok {
+			unsupported = append(unsupported, c)
+			o.diag.add(DiagnosticUnknownCode, c.Code, offsets[idx], &UnsupportedChunkError{Code: c.Code})
+			continue
+		}
+		if selected[c.Code] != idx {
+			continue
+		}
 
-			if f.Compat > maxCompat {
-				maxCompat = f.Compat
+		asset := &Img{
+			Format: f,
+			Data:   c.Data, // shares the memory of the file, like the raw elements
+		}
+
+		if idx == limitIdx {
+			return nil, limitErr
+		}
+		if pre == nil {
+			if err := lim.decode(f, offsets[idx], c.Data); err != nil {
+				return nil, err
 			}
+		}
 
-			masks[code] = i
+		if o.lazy {
+			l := &lazyImage{
+				format: f,
+				dec:    o.decoderFor(f, c.Data),
+				offset: offsets[idx],
+				data:   c.Data,
+				keep:   o.dimensions == DimensionsKeep,
+			}
+			if m := masks[f.CombineCode]; m != nil {
+				if !o.noComposit {
+					l.mask = m
+				}
+				asset.mask = m
+				usedMasks[f.CombineCode] = true
+			} else if f.CombineCode != 0 {
+				o.diag.add(DiagnosticMaskPairing, c.Code, offsets[idx],
+					fmt.Errorf("no %s mask found for the image", CodeString(f.CombineCode)))
+			}
+			asset.Image = l
+			asset.src = l
+			asset.Encoder = sniffEncoder(f, c.Data)
+			asset.stored = dataEncoding(asset.Encoder, c.Data)
+			assets = append(assets, asset)
+			updateCompat(f)
+			continue
+		}
 
+		var d decodedImage
+		if pre != nil {
+			d = pre[idx]
+		} else {
+			d = o.decodeImage(f, c.Data)
+		}
+		i, enc, err := d.img, d.enc, d.err
+		if err != nil {
+			if o.strict {
+				return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+			}
+			o.diag.add(DiagnosticCodecError, c.Code, offsets[idx], err)
 			continue
 		}
 
-		if f, ok := supportedImageFormats[code]; ok {
-			asset := &Img{
-				Format: f,
+		if b := i.Bounds(); b.Dx() != int(f.Res) || b.Dy() != int(f.Res) {
+			err := fmt.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), f.Res, f.Res)
+			policy := o.dimensions
+			if o.strict && policy == DimensionsSkip {
+				policy = DimensionsReject
+			}
+			switch policy {
+			case DimensionsReject:
+				return nil, &ChunkError{Code: c.Code, Offset: offsets[idx], Err: err}
+			case DimensionsSkip:
+				o.diag.add(DiagnosticDimensionMismatch, c.Code, offsets[idx], err)
+				continue
+			default:
+				o.diag.add(DiagnosticDimensionMismatch, c.Code, offsets[idx], err)
 			}
+		}
 
-			if !metaOnly {
+		if m := masks[f.CombineCode]; m != nil {
+			if !o.noComposit {
+				i = composite(i, m, f.Res)
+			}
+			asset.mask = m
+			usedMasks[f.CombineCode] = true
+		} else if f.CombineCode != 0 {
+			o.diag.add(DiagnosticMaskPairing, c.Code, offsets[idx],
+				fmt.Errorf("no %s mask found for the image", CodeString(f.CombineCode)))
+		}
 
-				// make a copy of data for later usage
-				dst := make([]byte, len(*sub))
-				copy(dst, *sub)
-				asset.Data = dst
+		asset.Image = i
+		asset.src = i
+		asset.Encoder = enc
+		asset.stored = dataEncoding(enc, c.Data)
 
-				i, enc, err := f.Codec.Decode(sub, f.Res)
-				if err != nil {
-					continue
-				}
+		assets = append(assets, asset)
+		updateCompat(f)
+	}
 
-				// TODO: don't assume the mask is parsed first
-				if m := masks[f.CombineCode]; m != nil {
-					r := image.Rect(0, 0, int(f.Res), int(f.Res))
+	for _, c := range chunks {
+		if masks[c.Code] != nil && !usedMasks[c.Code] {
+			usedMasks[c.Code] = true // only report once
+			o.diag.add(DiagnosticMaskPairing, c.Code, maskOffsets[c.Code], fmt.Errorf("mask not used by any image"))
+		}
+	}
 
-					c := image.NewRGBA(r)
+	return &ICNS{
+		minCompat:   minCompat,
+		maxCompat:   maxCompat,
+		Assets:      assets,
+		chunks:      chunks,
+		unsupported: unsupported,
+		dark:        dark,
+	}, nil
+}
 
-					draw.DrawMask(c, r, i, image.Pt(0, 0), m, image.Pt(0, 0), draw.Over)
-					i = c
-				}
+// decodedImage is the result of the decoding of an image.
+type decodedImage struct {
+	img image.Image
+	enc string
+	err error
+}
 
-				asset.Image = i
-				asset.Encoder = enc
-			}
+// WithImageDecoders replaces the PNG and JPEG decoders of the standard library,
+// unless nil, for instance with faster implementations.
+func WithImageDecoders(pngFormat, jpegFormat codec.ImageFormat) DecodeOption {
+	return func(o *decodeOptions) {
+		o.images = codec.PNGFormatCodec(pngFormat, jpegFormat)
+	}
+}
 
-			assets = append(assets, asset)
+// decoderFor returns the codec decoding data stored under the format, using the
+// image decoders of the options.
+func (o *decodeOptions) decoderFor(f *Format, data []byte) codec.Codec {
+	c := f.decoderFor(data)
+	if c == codec.ImageCodec && o.images != nil {
+		return o.images
+	}
+	return c
+}
 
-			if f.Compat < minCompat {
-				minCompat = f.Compat
-			}
+func (o *decodeOptions) decodeImage(f *Format, data []byte) decodedImage {
+	r := binary.Reader(data)
+	img, enc, err := o.decoderFor(f, data).Decode(&r, f.Res)
+	return decodedImage{img: img, enc: enc, err: err}
+}
+
+// composite applies the mask of a legacy image.
+func composite(i, m image.Image, res Resolution) image.Image {
+	r := image.Rect(0, 0, int(res), int(res))
+	c := image.NewRGBA(r)
+	draw.DrawMask(c, r, i, image.Pt(0, 0), m, image.Pt(0, 0), draw.Over)
+	return c
+}
 
-			if f.Compat > maxCompat {
-				maxCompat = f.Compat
+// Decode loads a .icns file from the provided reader.
+func Decode(r io.Reader, opts ...DecodeOption) (*ICNS, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.streaming {
+		return decodeStream(r, o)
+	}
+
+	bytes, err := readAll(r, o)
+	if err != nil {
+		return nil, err
+	}
+	return readICNS(bytes, o)
+}
+
+// DecodeAll loads all the icons of a stream made of several concatenated .icns files.
+// Each icon is delimited by the size in its header.
+func DecodeAll(r io.Reader, opts ...DecodeOption) ([]*ICNS, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := readAll(r, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*ICNS
+	offset := 0
+	for offset < len(data) {
+		hdr := binary.Reader(data[offset:])
+		if _, err := hdr.Uint32(); err != nil { // magic, checked by readICNS
+			return nil, fmt.Errorf("icon %d at offset %d: %w", len(res), offset, err)
+		}
+		size, err := hdr.Uint32()
+		if err != nil {
+			return nil, fmt.Errorf("icon %d at offset %d: %w", len(res), offset, err)
+		}
+		if size < 8 || int64(size) > int64(len(data)-offset) {
+			return nil, fmt.Errorf("icon %d at offset %d: invalid size %d, %d bytes available", len(res), offset, size, len(data)-offset)
+		}
+
+		i, err := readICNS(data[offset:offset+int(size)], o)
+		if err != nil {
+			return nil, fmt.Errorf("icon %d at offset %d: %w", len(res), offset, err)
+		}
+		res = append(res, i)
+		offset += int(size)
+	}
+	return res, nil
+}
+
+// DecodeAt loads a .icns file of the provided size from r. Unlike Decode, it reads
+// the elements one at a time at their offset, which suits icons stored in larger
+// containers such as archives or disk images.
+func DecodeAt(r io.ReaderAt, size int64, opts ...DecodeOption) (*ICNS, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if max := o.limits.MaxFileSize; max > 0 && size > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: size, Max: max}
+	}
+
+	buf := make([]byte, 8)
+	if err := readAt(r, buf, 0); err != nil {
+		return nil, fmt.Errorf("cannot read ICNS header: %w", err)
+	}
+	hdr := binary.Reader(buf)
+	if m, _ := hdr.Uint32(); m != magic {
+		return nil, fmt.Errorf("wrong magic number for ICNS file: %x", m)
+	}
+
+	lim := &limiter{Limits: o.limits}
+
+	var chunks []Chunk
+	var offsets []int
+	for offset := int64(8); offset < size; {
+		available := size - offset
+		if err := readAt(r, buf, offset); err != nil {
+			return nil, fmt.Errorf("cannot read element header at offset %d: %w", offset, err)
+		}
+		hdr := binary.Reader(buf)
+		code, _ := hdr.Uint32()
+		chunkSize, _ := hdr.Uint32()
+		if chunkSize < 8 || int64(chunkSize) > available {
+			return nil, &ChunkSizeError{
+				Code:      code,
+				Offset:    int(offset),
+				Declared:  int(chunkSize),
+				Available: int(available),
 			}
+		}
+		if err := lim.chunk(code, int(offset), int(chunkSize)); err != nil {
+			return nil, err
+		}
 
-			continue
+		data := make([]byte, chunkSize-8)
+		if err := readAt(r, data, offset+8); err != nil {
+			return nil, &ChunkError{Code: code, Offset: int(offset), Err: err}
 		}
 
-		unsupportedCodes = append(unsupportedCodes, code)
+		offsets = append(offsets, int(offset))
+		chunks = append(chunks, Chunk{
+			Code: code,
+			Data: data,
+		})
+		offset += int64(chunkSize)
 	}
 
-	return &ICNS{
-		minCompat:        minCompat,
-		maxCompat:        maxCompat,
-		Assets:           assets,
-		unsupportedCodes: unsupportedCodes,
-	}, nil
+	return decodeChunks(chunks, offsets, o, lim)
 }
 
-// Decode loads a .icns file from the provided reader.
-func Decode(r io.Reader) (*ICNS, error) {
+// readAt fills p from r at offset off. A short read is reported as io.ErrUnexpectedEOF,
+// as the decoding of a byte slice does.
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readAll reads the whole content of r, honoring the file size limit.
+func readAll(r io.Reader, o decodeOptions) ([]byte, error) {
+	if o.limits.MaxFileSize > 0 {
+		r = io.LimitReader(r, o.limits.MaxFileSize+1)
+	}
 	bytes, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	return readICNS(bytes, false)
+	if max := o.limits.MaxFileSize; max > 0 && int64(len(bytes)) > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: int64(len(bytes)), Max: max}
+	}
+	return bytes, nil
 }
@@ -0,0 +1,551 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/codec"
+)
+
+// rawICNS builds an icon file made of the provided chunks, written as is.
+func rawICNS(t test, chunks ...Chunk) []byte {
+	t.Helper()
+
+	i := NewICNS()
+	for _, c := range chunks {
+		i.AddRawChunk(c.Code, c.Data)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeStrict(t *testing.T) {
+	t.Parallel()
+	data := rawICNS(t,
+		Chunk{Code: CodeIc07, Data: []byte("not an image")},
+	)
+
+	i, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("lenient decoding failed: %v", err)
+	}
+	if len(i.Assets) != 0 {
+		t.Errorf("unexpected assets: %d", len(i.Assets))
+	}
+
+	_, err = Decode(bytes.NewReader(data), WithStrictDecoding())
+	var cerr *ChunkError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("strict decoding: got %v, want a *ChunkError", err)
+	}
+	if cerr.Code != CodeIc07 || cerr.Offset != 8 {
+		t.Errorf("unexpected error location: got %s at %d, want ic07 at 8", CodeString(cerr.Code), cerr.Offset)
+	}
+}
+
+func TestDecodeDiagnostics(t *testing.T) {
+	t.Parallel()
+	const unknown uint32 = 'x'<<24 | 'x'<<16 | 'x'<<8 | 'x'
+	data := rawICNS(t,
+		Chunk{Code: CodeIc07, Data: []byte("not an image")},
+		Chunk{Code: unknown, Data: []byte("whatever")},
+		Chunk{Code: CodeS8mk, Data: make([]byte, 16*16)},
+	)
+
+	var d Diagnostics
+	if _, err := Decode(bytes.NewReader(data), WithDiagnostics(&d)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		kind DiagnosticKind
+		code uint32
+	}{
+		{DiagnosticCodecError, CodeIc07},
+		{DiagnosticUnknownCode, unknown},
+		{DiagnosticMaskPairing, CodeS8mk},
+	}
+	if len(d.Entries) != len(want) {
+		t.Fatalf("unexpected diagnostics:\n%s", d.String())
+	}
+	for idx, w := range want {
+		if e := d.Entries[idx]; e.Kind != w.kind || e.Code != w.code {
+			t.Errorf("diagnostic %d: got %s", idx, e)
+		}
+	}
+}
+
+func TestDecodeMaskOrder(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 16; y++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: 0xff, A: 0xff})
+		}
+	}
+
+	i := NewICNS(WithMaxCompatibility(Allegro))
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := dec.RawChunks()
+	if len(chunks) != 2 || chunks[0].Code != CodeIl32 {
+		t.Fatalf("unexpected chunks: %v", chunks)
+	}
+
+	for _, order := range [][]Chunk{
+		{chunks[0], chunks[1]},
+		{chunks[1], chunks[0]},
+	} {
+		data := rawICNS(t, order...)
+
+		dec, err = Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := dec.ByResolution(Pixel32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, a := img.At(0, 0).RGBA(); a != 0xffff {
+			t.Errorf("[%s first] unexpected alpha in the opaque area: %#x", CodeString(order[0].Code), a)
+		}
+		if _, _, _, a := img.At(0, 31).RGBA(); a != 0 {
+			t.Errorf("[%s first] unexpected alpha in the transparent area: %#x", CodeString(order[0].Code), a)
+		}
+	}
+}
+
+func TestDecodeChunkSize(t *testing.T) {
+	t.Parallel()
+	valid := rawICNS(t, Chunk{Code: CodeIc07, Data: []byte("data")})
+
+	data := []struct {
+		name     string
+		size     uint32
+		declared int
+	}{
+		{"too small", 4, 4},
+		{"too large", 100, 100},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := append([]byte(nil), valid...)
+			b[12], b[13], b[14], b[15] = byte(tt.size>>24), byte(tt.size>>16), byte(tt.size>>8), byte(tt.size)
+
+			_, err := Decode(bytes.NewReader(b))
+			var serr *ChunkSizeError
+			if !errors.As(err, &serr) {
+				t.Fatalf("got %v, want a *ChunkSizeError", err)
+			}
+			if serr.Code != CodeIc07 || serr.Offset != 8 || serr.Declared != tt.declared || serr.Available != 12 {
+				t.Errorf("unexpected error: %v", serr)
+			}
+		})
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	t.Parallel()
+	full, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every truncation must be reported as an error, or decode what is left, without panicking
+	for n := 0; n < 64; n++ {
+		if _, err := Decode(bytes.NewReader(full[:n])); err == nil && n < 8 {
+			t.Errorf("Decode(%d bytes): expected an error for a truncated header", n)
+		}
+	}
+	for n := 64; n < len(full); n += 997 {
+		_, _ = Decode(bytes.NewReader(full[:n]))
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		name   string
+		limits Limits
+		limit  string
+	}{
+		{"file size", Limits{MaxFileSize: 1024}, "MaxFileSize"},
+		{"chunk size", Limits{MaxChunkSize: 32 * 1024}, "MaxChunkSize"},
+		{"pixels", Limits{MaxPixels: 512 * 512}, "MaxPixels"},
+		{"assets", Limits{MaxAssets: 3}, "MaxAssets"},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Decode(testdataFileReader(t, "mit.icns"), WithLimits(tt.limits))
+			var lerr *LimitError
+			if !errors.As(err, &lerr) {
+				t.Fatalf("got %v, want a *LimitError", err)
+			}
+			if lerr.Limit != tt.limit {
+				t.Errorf("unexpected limit: got %s, want %s", lerr.Limit, tt.limit)
+			}
+		})
+	}
+
+	if _, err := Decode(testdataFileReader(t, "mit.icns"), WithLimits(Limits{MaxPixels: 4 << 20, MaxAssets: 11})); err != nil {
+		t.Errorf("decoding within limits: %v", err)
+	}
+}
+
+// darkICNS builds an icon file made of a 16px image and the provided dark icon, if any.
+func darkICNS(t test, dark []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	chunks := []Chunk{{Code: CodeIcp4, Data: buf.Bytes()}}
+	if dark != nil {
+		chunks = append(chunks, Chunk{Code: CodeDark, Data: dark})
+	}
+	return rawICNS(t, chunks...)
+}
+
+func TestDecodeDarkLimits(t *testing.T) {
+	t.Parallel()
+	data := darkICNS(t, darkICNS(t, nil))
+
+	_, err := Decode(bytes.NewReader(data), WithLimits(Limits{MaxAssets: 1}))
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != "MaxAssets" {
+		t.Fatalf("got %v, want a MaxAssets *LimitError", err)
+	}
+
+	if _, err := Decode(bytes.NewReader(data), WithLimits(Limits{MaxAssets: 2})); err != nil {
+		t.Errorf("decoding within limits: %v", err)
+	}
+}
+
+func TestDecodeNestedDark(t *testing.T) {
+	t.Parallel()
+	data := darkICNS(t, nil)
+	for n := 0; n < 6; n++ {
+		data = darkICNS(t, data)
+	}
+
+	var d Diagnostics
+	i, err := Decode(bytes.NewReader(data), WithDiagnostics(&d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Dark() == nil {
+		t.Fatal("missing dark icon")
+	}
+	if i.Dark().Dark() != nil {
+		t.Error("unexpected dark icon nested in the dark icon")
+	}
+	if len(d.Entries) != 1 || d.Entries[0].Kind != DiagnosticSkipped || d.Entries[0].Code != CodeDark {
+		t.Errorf("unexpected diagnostics:\n%s", d.String())
+	}
+
+	_, err = Decode(bytes.NewReader(data), WithStrictDecoding())
+	var cerr *ChunkError
+	if !errors.As(err, &cerr) || cerr.Code != CodeDark {
+		t.Errorf("strict decoding: got %v, want a *ChunkError for the dark icon", err)
+	}
+}
+
+func TestDecodeDuplicateDark(t *testing.T) {
+	t.Parallel()
+	dark := darkICNS(t, nil)
+	data := rawICNS(t, Chunk{Code: CodeDark, Data: dark}, Chunk{Code: CodeDark, Data: dark})
+
+	var d Diagnostics
+	i, err := Decode(bytes.NewReader(data), WithDiagnostics(&d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Dark() == nil {
+		t.Fatal("missing dark icon")
+	}
+	if len(d.Entries) != 1 || d.Entries[0].Kind != DiagnosticSkipped || d.Entries[0].Offset != 8+8+len(dark) {
+		t.Errorf("unexpected diagnostics:\n%s", d.String())
+	}
+
+	_, err = Decode(bytes.NewReader(data), WithDuplicatePolicy(DuplicateError))
+	var cerr *ChunkError
+	if !errors.As(err, &cerr) || cerr.Code != CodeDark {
+		t.Errorf("got %v, want a *ChunkError for the second dark icon", err)
+	}
+}
+
+func TestDecodeDimensionPolicy(t *testing.T) {
+	t.Parallel()
+	// a 64px image stored as ic07, which should be 128px
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	data := rawICNS(t, Chunk{Code: CodeIc07, Data: buf.Bytes()})
+
+	var d Diagnostics
+	i, err := Decode(bytes.NewReader(data), WithDiagnostics(&d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != 0 {
+		t.Errorf("mismatched image kept by default")
+	}
+	if len(d.Entries) != 1 || d.Entries[0].Kind != DiagnosticDimensionMismatch {
+		t.Errorf("unexpected diagnostics:\n%s", d.String())
+	}
+
+	i, err = Decode(bytes.NewReader(data), WithDimensionPolicy(DimensionsKeep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != 1 {
+		t.Errorf("mismatched image not kept with DimensionsKeep")
+	}
+
+	if _, err := Decode(bytes.NewReader(data), WithDimensionPolicy(DimensionsReject)); err == nil {
+		t.Errorf("mismatched image not rejected with DimensionsReject")
+	}
+}
+
+func TestDecodeDuplicatePolicy(t *testing.T) {
+	t.Parallel()
+	chunk := func(c color.Color) Chunk {
+		img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return Chunk{Code: CodeIc07, Data: buf.Bytes()}
+	}
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	blue := color.NRGBA{B: 0xff, A: 0xff}
+	data := rawICNS(t, chunk(red), chunk(blue))
+
+	for _, tt := range []struct {
+		policy DuplicatePolicy
+		want   color.NRGBA
+	}{
+		{DuplicateKeepFirst, red},
+		{DuplicateKeepLast, blue},
+	} {
+		i, err := Decode(bytes.NewReader(data), WithDuplicatePolicy(tt.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(i.Assets) != 1 {
+			t.Fatalf("policy %d: got %d assets, want 1", tt.policy, len(i.Assets))
+		}
+		if got := color.NRGBAModel.Convert(i.Assets[0].Image.At(0, 0)); got != tt.want {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader(data), WithDuplicatePolicy(DuplicateError)); err == nil {
+		t.Errorf("duplicate not rejected with DuplicateError")
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	t.Parallel()
+	first := rawICNS(t, Chunk{Code: 'a'<<24 | 'a'<<16 | 'a'<<8 | 'a', Data: []byte("first")})
+	second, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := DecodeAll(bytes.NewReader(append(first, second...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d icons, want 2", len(all))
+	}
+	if len(all[0].Assets) != 0 || len(all[0].unsupported) != 1 {
+		t.Errorf("unexpected first icon:\n%s", all[0].Info())
+	}
+	if len(all[1].Assets) != 10 {
+		t.Errorf("unexpected second icon:\n%s", all[1].Info())
+	}
+
+	if _, err := DecodeAll(bytes.NewReader(append(first, 'i', 'c'))); err == nil {
+		t.Error("expected an error for trailing data")
+	}
+}
+
+func TestDecodeWithoutMaskCompositing(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	src.SetNRGBA(0, 0, color.NRGBA{G: 0xff, A: 0xff})
+
+	i := NewICNS(WithMaxCompatibility(Allegro))
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := Decode(bytes.NewReader(buf.Bytes()), WithoutMaskCompositing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := dec.ByResolution(Pixel16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(1, 1).RGBA(); a != 0xffff {
+		t.Errorf("image composited with its mask: alpha %#x", a)
+	}
+	mask, err := dec.MaskByResolution(Pixel16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := mask.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("unexpected mask value in the opaque area: %#x", a)
+	}
+	if _, _, _, a := mask.At(1, 1).RGBA(); a != 0 {
+		t.Errorf("unexpected mask value in the transparent area: %#x", a)
+	}
+
+	// the mask kept apart is written back
+	buf.Reset()
+	if err := Encode(buf, dec); err != nil {
+		t.Fatal(err)
+	}
+	dec, err = Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = dec.ByResolution(Pixel16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(1, 1).RGBA(); a != 0 {
+		t.Errorf("mask lost after encoding: alpha %#x", a)
+	}
+}
+
+func TestDecodeAt(t *testing.T) {
+	t.Parallel()
+	full, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(full))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the icon is read from the middle of a larger container
+	container := append(append([]byte("header"), full...), "trailer"...)
+	got, err := DecodeAt(io.NewSectionReader(bytes.NewReader(container), 6, int64(len(full))), int64(len(full)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Info(), got.Info()); diff != "" {
+		t.Errorf("unexpected icon (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.RawChunks(), got.RawChunks()); diff != "" {
+		t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+	}
+
+	for n := 0; n < len(full); n += 997 {
+		if _, err := DecodeAt(bytes.NewReader(full), int64(len(full)+n+1)); err == nil {
+			t.Errorf("DecodeAt(%d bytes past the end): expected an error", n+1)
+		}
+	}
+	if _, err := DecodeAt(bytes.NewReader(full[:4]), 4); err == nil {
+		t.Error("expected an error for a truncated header")
+	}
+	if _, err := DecodeAt(bytes.NewReader(full), int64(len(full)), WithLimits(Limits{MaxFileSize: 100})); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+}
+
+func TestDecodeSharesData(t *testing.T) {
+	t.Parallel()
+	full, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := Decode(bytes.NewReader(full))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := make(map[uint32][]byte)
+	for _, c := range i.RawChunks() {
+		chunks[c.Code] = c.Data
+	}
+	for _, a := range i.Assets {
+		if c := chunks[a.Format.Code]; len(a.Data) == 0 || &a.Data[0] != &c[0] {
+			t.Errorf("[%s] data copied from the file", CodeString(a.Format.Code))
+		}
+	}
+}
+
+func TestWithImageDecoders(t *testing.T) {
+	t.Parallel()
+	for _, opts := range [][]DecodeOption{nil, {WithLazyDecoding()}} {
+		p := &countingFormat{ImageFormat: codec.PNG(nil)}
+		j := &countingFormat{ImageFormat: codec.JPEG(0)}
+		i, err := Decode(testdataFileReader(t, "mit.icns"), append(opts, WithImageDecoders(p, j))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range i.Assets {
+			if _, err := a.AsImage(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p.decoded.Load() == 0 || j.decoded.Load() == 0 {
+			t.Errorf("got %d PNG and %d JPEG decoder calls, want both used", p.decoded.Load(), j.decoded.Load())
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package register registers the .icns format with the image package, so that
+// image.Decode and image.DecodeConfig recognize .icns files. It is meant to be
+// imported for its side effect only:
+//
+//	import _ "github.com/kroksys/icns/register"
+//
+// image.Decode returns the highest resolution image of the file, unless another
+// resolution is selected with SetResolution.
+package register
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	"github.com/kroksys/icns"
+)
+
+func init() {
+	image.RegisterFormat("icns", "icns", decode, decodeConfig)
+}
+
+var target atomic.Uint32
+
+// SetResolution selects the image returned by image.Decode: the smallest image at least
+// as large as r, or the largest image when there is none. The default, 0, selects the
+// largest image. It is safe for concurrent use.
+func SetResolution(r icns.Resolution) {
+	target.Store(uint32(r))
+}
+
+// pick returns the selected resolution among the provided ones, in increasing order.
+func pick(res []icns.Resolution) icns.Resolution {
+	r := icns.Resolution(target.Load())
+	for _, x := range res {
+		if r != 0 && x >= r {
+			return x
+		}
+	}
+	return res[len(res)-1]
+}
+
+func decode(r io.Reader) (image.Image, error) {
+	i, err := icns.Decode(r, icns.WithLazyDecoding())
+	if err != nil {
+		return nil, err
+	}
+	var res []icns.Resolution
+	byRes := make(map[icns.Resolution]*icns.Img)
+	for _, a := range i.Assets {
+		if byRes[a.Format.Res] == nil {
+			byRes[a.Format.Res] = a
+			res = append(res, a.Format.Res)
+		}
+	}
+	if len(res) == 0 {
+		return nil, icns.ErrNoImage
+	}
+	sort.Slice(res, func(x, y int) bool { return res[x] < res[y] })
+	return byRes[pick(res)].AsImage()
+}
+
+func decodeConfig(r io.Reader) (image.Config, error) {
+	res, err := icns.Resolutions(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if len(res) == 0 {
+		return image.Config{}, icns.ErrNoImage
+	}
+	want := pick(res)
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(want),
+		Height:     int(want),
+	}, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register_test
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kroksys/icns"
+	"github.com/kroksys/icns/register"
+)
+
+func TestDecode(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "testdata", "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, format, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "icns" {
+		t.Errorf("unexpected image format: got %s, want icns", format)
+	}
+	if b := img.Bounds(); b.Dx() != 1024 || b.Dy() != 1024 {
+		t.Errorf("unexpected image size: got %dx%d, want 1024x1024", b.Dx(), b.Dy())
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "testdata", "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "icns" {
+		t.Errorf("unexpected image format: got %s, want icns", format)
+	}
+	if cfg.Width != 1024 || cfg.Height != 1024 {
+		t.Errorf("unexpected image size: got %dx%d, want 1024x1024", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSetResolution(t *testing.T) {
+	// not parallel: changes the resolution used by the other tests
+	defer register.SetResolution(0)
+	data, err := os.ReadFile(filepath.Join("..", "testdata", "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		res  icns.Resolution
+		want int
+	}{
+		{0, 1024},
+		{icns.Pixel16, 16},
+		{100, 128},
+		{icns.Pixel512, 512},
+		{2048, 1024},
+	} {
+		register.SetResolution(tc.res)
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%dpx: %v", tc.res, err)
+		}
+		if b := img.Bounds(); b.Dx() != tc.want {
+			t.Errorf("%dpx: got %dpx image, want %dpx", tc.res, b.Dx(), tc.want)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%dpx: %v", tc.res, err)
+		}
+		if cfg.Width != tc.want {
+			t.Errorf("%dpx: got %dpx config, want %dpx", tc.res, cfg.Width, tc.want)
+		}
+	}
+}
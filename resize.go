@@ -0,0 +1,375 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Scaler resamples images to the resolutions of the icon formats.
+type Scaler interface {
+	// Scale scales src to fill the bounds of dst.
+	Scale(dst draw.Image, src image.Image)
+}
+
+// ScalerFunc is an adapter to use ordinary functions as scalers.
+type ScalerFunc func(dst draw.Image, src image.Image)
+
+// Scale calls f(dst, src).
+func (f ScalerFunc) Scale(dst draw.Image, src image.Image) {
+	f(dst, src)
+}
+
+// Filter is a resampling filter, usable as a Scaler.
+type Filter uint8
+
+const (
+	// FilterNearest uses nearest-neighbor interpolation, which is fast but low quality.
+	FilterNearest Filter = iota
+	// FilterBilinear uses bilinear interpolation.
+	FilterBilinear
+	// FilterBicubic uses the Catmull-Rom bicubic kernel.
+	FilterBicubic
+	// FilterLanczos uses the Lanczos kernel with 3 lobes, which keeps small sizes sharper.
+	FilterLanczos
+)
+
+// defaultScaler is used when no scaler is set.
+const defaultScaler = FilterBicubic
+
+var lanczos = &xdraw.Kernel{
+	Support: 3,
+	At: func(t float64) float64 {
+		if t == 0 {
+			return 1
+		}
+		if t >= 3 {
+			return 0
+		}
+		x := math.Pi * t
+		return 3 * math.Sin(x) * math.Sin(x/3) / (x * x)
+	},
+}
+
+func (f Filter) String() string {
+	switch f {
+	case FilterNearest:
+		return "nearest"
+	case FilterBilinear:
+		return "bilinear"
+	case FilterBicubic:
+		return "bicubic"
+	case FilterLanczos:
+		return "lanczos"
+	}
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// Scale scales src to fill the bounds of dst with the filter.
+func (f Filter) Scale(dst draw.Image, src image.Image) {
+	var s xdraw.Scaler
+	switch f {
+	case FilterNearest:
+		s = xdraw.NearestNeighbor
+	case FilterBilinear:
+		s = xdraw.BiLinear
+	case FilterLanczos:
+		s = lanczos
+	default:
+		s = xdraw.CatmullRom
+	}
+	s.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Src, nil)
+}
+
+// WithFilter sets the resampling filter used by FromImage, AddFit and FillMissing (defaults to FilterBicubic).
+// It replaces any scaler set with WithScaler.
+func WithFilter(f Filter) Option {
+	return WithScaler(f)
+}
+
+// WithScaler sets the scaler used by FromImage, AddFit and FillMissing (defaults to FilterBicubic).
+func WithScaler(s Scaler) Option {
+	return func(i *ICNS) {
+		i.scaler = s
+	}
+}
+
+// FromImage creates an icon holding the provided image, resampled to every resolution
+// supported within the compatibility range set by the options.
+func FromImage(img image.Image, opts ...Option) (*ICNS, error) {
+	i := NewICNS(opts...)
+
+	img = i.square(img)
+	b := img.Bounds()
+	if b.Dx() != b.Dy() {
+		return nil, ErrNotSquare
+	}
+
+	resolutions := SupportedResolutions(i.minCompat, i.maxCompat)
+	if len(resolutions) == 0 {
+		return nil, ErrUnsupportedResolution
+	}
+
+	for _, r := range resolutions {
+		if err := i.Add(i.resize(img, r)); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// resize returns img scaled to the provided resolution, or img itself when it already has that size.
+func (i *ICNS) resize(img image.Image, r Resolution) image.Image {
+	img = decoded(img)
+	b := img.Bounds()
+	if b.Dx() == int(r) && b.Dy() == int(r) {
+		return img
+	}
+
+	s := i.scaler
+	if s == nil {
+		s = defaultScaler
+	}
+	rect := image.Rect(0, 0, int(r), int(r))
+	if i.linear {
+		dst := image.NewRGBA64(rect)
+		s.Scale(dst, toLinear(img))
+		return fromLinear(dst)
+	}
+	dst := image.NewNRGBA(rect)
+	s.Scale(dst, img)
+	return dst
+}
+
+// WithLinearLight resamples images in linear light instead of sRGB space, which avoids
+// darkening the fine details and edges of downscaled images.
+func WithLinearLight() Option {
+	return func(i *ICNS) {
+		i.linear = true
+	}
+}
+
+var (
+	gammaOnce            sync.Once
+	srgbToLin, linToSrgb []uint16
+)
+
+func gammaTables() {
+	srgbToLin = make([]uint16, 1<<16)
+	linToSrgb = make([]uint16, 1<<16)
+	for v := range srgbToLin {
+		c := float64(v) / 0xffff
+		if c <= 0.04045 {
+			c /= 12.92
+		} else {
+			c = math.Pow((c+0.055)/1.055, 2.4)
+		}
+		srgbToLin[v] = uint16(math.Round(c * 0xffff))
+
+		c = float64(v) / 0xffff
+		if c <= 0.0031308 {
+			c *= 12.92
+		} else {
+			c = 1.055*math.Pow(c, 1/2.4) - 0.055
+		}
+		linToSrgb[v] = uint16(math.Round(c * 0xffff))
+	}
+}
+
+// toLinear converts img to alpha-premultiplied linear light values.
+func toLinear(img image.Image) *image.RGBA64 {
+	gammaOnce.Do(gammaTables)
+	b := img.Bounds()
+	res := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			res.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(uint32(srgbToLin[c.R]) * uint32(c.A) / 0xffff),
+				G: uint16(uint32(srgbToLin[c.G]) * uint32(c.A) / 0xffff),
+				B: uint16(uint32(srgbToLin[c.B]) * uint32(c.A) / 0xffff),
+				A: c.A,
+			})
+		}
+	}
+	return res
+}
+
+// fromLinear converts alpha-premultiplied linear light values back to sRGB.
+func fromLinear(img *image.RGBA64) *image.NRGBA {
+	b := img.Bounds()
+	res := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.RGBA64At(x, y)).(color.NRGBA64)
+			res.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(linToSrgb[c.R] >> 8),
+				G: uint8(linToSrgb[c.G] >> 8),
+				B: uint8(linToSrgb[c.B] >> 8),
+				A: uint8(c.A >> 8),
+			})
+		}
+	}
+	return res
+}
+
+// AddFit adds a square image of any size to the icon, resampled to the closest resolution
+// supported within the compatibility range of the icon. It returns that resolution.
+// The options are the ones of Add.
+func (i *ICNS) AddFit(im image.Image, opts ...AddOption) (Resolution, error) {
+	im = i.square(im)
+	b := im.Bounds()
+	if b.Dx() != b.Dy() {
+		return 0, ErrNotSquare
+	}
+
+	var best Resolution
+	dist := func(r Resolution) int {
+		d := int(r) - b.Dx()
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	for _, r := range SupportedResolutions(i.minCompat, i.maxCompat) {
+		if best == 0 || dist(r) <= dist(best) {
+			best = r
+		}
+	}
+	if best == 0 {
+		return 0, ErrUnsupportedResolution
+	}
+
+	return best, i.Add(i.resize(im, best), opts...)
+}
+
+// WithPadding makes Add, AddFit and FromImage accept images that are not square,
+// centering them on a transparent square canvas.
+func WithPadding() Option {
+	return func(i *ICNS) {
+		i.pad = true
+	}
+}
+
+// square returns img centered on a transparent square canvas when padding is enabled,
+// and img itself otherwise.
+func (i *ICNS) square(img image.Image) image.Image {
+	b := img.Bounds()
+	if !i.pad || b.Dx() == b.Dy() {
+		return img
+	}
+
+	size := max(b.Dx(), b.Dy())
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	off := image.Pt((size-b.Dx())/2, (size-b.Dy())/2)
+	draw.Draw(dst, b.Sub(b.Min).Add(off), img, b.Min, draw.Src)
+	return dst
+}
+
+// FillOption is the type for FillMissing options.
+type FillOption func(*fillOptions)
+
+type fillOptions struct {
+	noUpscale bool
+}
+
+// WithoutUpscaling only fills the formats for which a larger image is available.
+func WithoutUpscaling() FillOption {
+	return func(o *fillOptions) {
+		o.noUpscale = true
+	}
+}
+
+// FillMissing adds an image for every format supported within the compatibility range
+// of the icon that has none, scaling down the closest larger image, or scaling up
+// the largest one when no larger image is available.
+func (i *ICNS) FillMissing(opts ...FillOption) error {
+	var o fillOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(i.Assets) == 0 {
+		return fmt.Errorf("no image to scale")
+	}
+
+	scaled := make(map[Resolution]image.Image)
+	for _, f := range i.MissingFor(i.minCompat, i.maxCompat) {
+		img, ok := scaled[f.Res]
+		if !ok {
+			src, simg, err := i.scaleSource(f.Res)
+			if err != nil {
+				return err
+			}
+			if o.noUpscale && src.Format.Res < f.Res {
+				continue
+			}
+			img = i.resize(simg, f.Res)
+			scaled[f.Res] = img
+		}
+		i.Assets = append(i.Assets, &Img{
+			Image:  img,
+			Format: f,
+		})
+	}
+	return nil
+}
+
+// scaleSource returns the best image to scale to the provided resolution: the smallest
+// image at least as large, preferring modern formats, or the largest image. Assets whose
+// image cannot be decoded are passed over; the error of the last one is returned when
+// no image is left.
+func (i *ICNS) scaleSource(r Resolution) (*Img, image.Image, error) {
+	failed := make(map[*Img]bool)
+	err := ErrNoImage
+	for {
+		best := i.scaleCandidate(r, failed)
+		if best == nil {
+			return nil, nil, err
+		}
+		img, aerr := best.AsImage()
+		if aerr == nil {
+			return best, img, nil
+		}
+		failed[best], err = true, aerr
+	}
+}
+
+func (i *ICNS) scaleCandidate(r Resolution, failed map[*Img]bool) *Img {
+	var best *Img
+	for _, a := range i.Assets {
+		switch {
+		case failed[a]:
+		case best == nil:
+			best = a
+		case best.Format.Res < r:
+			if a.Format.Res > best.Format.Res {
+				best = a
+			}
+		case a.Format.Res >= r && a.Format.Res < best.Format.Res:
+			best = a
+		case a.Format.Res == best.Format.Res && best.Format.legacy() && !a.Format.legacy():
+			best = a
+		}
+	}
+	return best
+}
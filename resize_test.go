@@ -0,0 +1,287 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestFromImage(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 1024, 1024))
+	for idx := range src.Pix {
+		src.Pix[idx] = 0x80
+	}
+
+	i, err := FromImage(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Assets) != len(supportedImageFormats) {
+		t.Errorf("got %d images, want %d:\n%s", len(i.Assets), len(supportedImageFormats), i.Info())
+	}
+	for _, a := range i.Assets {
+		b := a.Image.Bounds()
+		if b.Dx() != int(a.Format.Res) || b.Dy() != int(a.Format.Res) {
+			t.Errorf("[%s] got %dx%d image", CodeString(a.Format.Code), b.Dx(), b.Dy())
+		}
+		if c := color.NRGBAModel.Convert(a.Image.At(b.Dx()/2, b.Dy()/2)); c != (color.NRGBA{0x80, 0x80, 0x80, 0x80}) {
+			t.Errorf("[%s] unexpected color %v", CodeString(a.Format.Code), c)
+		}
+	}
+	if a, _ := i.ByCode(CodeIc10); a == nil || a.Image != image.Image(src) {
+		t.Error("the source image was not used as is at its own resolution")
+	}
+
+	i, err = FromImage(src, WithMinCompatibility(Lion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range i.Assets {
+		if a.Format.Compat < Lion {
+			t.Errorf("[%s] unexpected image outside of the compatibility range", CodeString(a.Format.Code))
+		}
+	}
+
+	if _, err := FromImage(image.NewNRGBA(image.Rect(0, 0, 32, 16))); err == nil {
+		t.Error("expected an error for a non-square image")
+	}
+}
+
+func TestFillMissing(t *testing.T) {
+	t.Parallel()
+	i := NewICNS(WithMinCompatibility(Leopard))
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 256, 256))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.FillMissing(WithoutUpscaling()); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range i.Assets {
+		if a.Format.Res > Pixel256 {
+			t.Errorf("[%s] unexpected upscaled image", CodeString(a.Format.Code))
+		}
+		if b := a.Image.Bounds(); b.Dx() != int(a.Format.Res) {
+			t.Errorf("[%s] got %dpx image", CodeString(a.Format.Code), b.Dx())
+		}
+	}
+	if _, err := i.ByCode(CodeIcp4); err != nil {
+		t.Error(err)
+	}
+
+	if err := i.FillMissing(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range supportedImageFormats {
+		if _, err := i.ByCode(f.Code); (err == nil) != (f.Compat >= Leopard) {
+			t.Errorf("[%s] image present: %v", CodeString(f.Code), err == nil)
+		}
+	}
+
+	if err := NewICNS().FillMissing(); err == nil {
+		t.Error("expected an error for an empty icon")
+	}
+}
+
+func TestWithScaler(t *testing.T) {
+	t.Parallel()
+	var calls int
+	s := ScalerFunc(func(dst draw.Image, src image.Image) {
+		calls++
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	})
+
+	i, err := FromImage(image.NewNRGBA(image.Rect(0, 0, 64, 64)), WithMinCompatibility(Lion), WithScaler(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 {
+		t.Fatal("custom scaler not used")
+	}
+	for _, a := range i.Assets {
+		want := color.Color(color.White)
+		if a.Format.Res == Pixel64 {
+			want = color.Transparent
+		}
+		if r, g, b, al := a.Image.At(0, 0).RGBA(); [4]uint32{r, g, b, al} != rgba(want) {
+			t.Errorf("[%s] unexpected color %v", CodeString(a.Format.Code), a.Image.At(0, 0))
+		}
+	}
+
+	calls = 0
+	i.Remove(Pixel16)
+	if err := i.Filter(func(*Img) bool { return true }).FillMissing(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("custom scaler called %d times, want 1", calls)
+	}
+}
+
+func rgba(c color.Color) [4]uint32 {
+	r, g, b, a := c.RGBA()
+	return [4]uint32{r, g, b, a}
+}
+
+func TestWithFilter(t *testing.T) {
+	t.Parallel()
+	// vertical stripes, two pixels wide
+	src := image.NewGray(image.Rect(0, 0, 64, 64))
+	for idx := range src.Pix {
+		if idx%4 < 2 {
+			src.Pix[idx] = 0xff
+		}
+	}
+
+	results := make(map[Filter]image.Image)
+	for _, f := range []Filter{FilterNearest, FilterBilinear, FilterBicubic, FilterLanczos} {
+		i, err := FromImage(src, WithMinCompatibility(Lion), WithFilter(f))
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		img, err := i.ByResolution(Pixel32)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		results[f] = img
+	}
+
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if g := color.GrayModel.Convert(results[FilterNearest].At(x, y)).(color.Gray).Y; g != 0 && g != 0xff {
+				t.Fatalf("nearest: interpolated value %#x at (%d, %d)", g, x, y)
+			}
+		}
+	}
+	for _, f := range []Filter{FilterBilinear, FilterLanczos} {
+		if utils.EqualImages(results[f], results[FilterBicubic]) {
+			t.Errorf("%v: same result as %v", f, FilterBicubic)
+		}
+	}
+}
+
+func TestWithLinearLight(t *testing.T) {
+	t.Parallel()
+	// black and white vertical lines, averaging to 50% gray in linear light
+	src := image.NewGray(image.Rect(0, 0, 64, 64))
+	for idx := range src.Pix {
+		if idx%2 == 0 {
+			src.Pix[idx] = 0xff
+		}
+	}
+
+	gray := func(opts ...Option) uint8 {
+		opts = append(opts, WithMinCompatibility(Lion), WithFilter(FilterBilinear))
+		i, err := FromImage(src, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := i.ByResolution(Pixel32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return color.GrayModel.Convert(img.At(16, 16)).(color.Gray).Y
+	}
+
+	if g := gray(); g < 0x70 || g > 0x90 {
+		t.Errorf("sRGB scaling: got %#x, want about 0x80", g)
+	}
+	if g := gray(WithLinearLight()); g < 0xb0 || g > 0xc0 {
+		t.Errorf("linear light scaling: got %#x, want about 0xbc", g)
+	}
+}
+
+func TestAddFit(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		size int
+		opts []Option
+		want Resolution
+	}{
+		{size: 16, want: Pixel16},
+		{size: 20, want: Pixel16},
+		{size: 24, want: Pixel32},
+		{size: 700, want: Pixel512},
+		{size: 4096, want: Pixel1024},
+		{size: 40, opts: []Option{WithMinCompatibility(Lion)}, want: Pixel32},
+		{size: 48, opts: []Option{WithMaxCompatibility(Allegro)}, want: Pixel48},
+	} {
+		i := NewICNS(tc.opts...)
+		got, err := i.AddFit(image.NewNRGBA(image.Rect(0, 0, tc.size, tc.size)))
+		if err != nil {
+			t.Fatalf("%dpx: %v", tc.size, err)
+		}
+		if got != tc.want {
+			t.Errorf("%dpx: got %dpx, want %dpx", tc.size, got, tc.want)
+		}
+		img, err := i.ByResolution(tc.want)
+		if err != nil {
+			t.Fatalf("%dpx: %v", tc.size, err)
+		}
+		if img.Bounds().Dx() != int(tc.want) {
+			t.Errorf("%dpx: image not resampled", tc.size)
+		}
+	}
+
+	if _, err := NewICNS().AddFit(image.NewNRGBA(image.Rect(0, 0, 32, 16))); err == nil {
+		t.Error("expected an error for a non-square image")
+	}
+}
+
+func TestWithPadding(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(10, 10, 42, 26))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	if err := NewICNS().Add(src); err == nil {
+		t.Error("expected an error for a non-square image without padding")
+	}
+
+	i := NewICNS(WithPadding())
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	img, err := i.ByResolution(Pixel32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		x, y int
+		want color.Color
+	}{
+		{0, 0, color.Transparent},
+		{16, 7, color.Transparent},
+		{16, 8, color.White},
+		{0, 23, color.White},
+		{31, 24, color.Transparent},
+	} {
+		if got := img.At(tc.x, tc.y); rgba(got) != rgba(tc.want) {
+			t.Errorf("(%d, %d): got %v, want %v", tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	if _, err := FromImage(image.NewNRGBA(image.Rect(0, 0, 100, 60)), WithPadding()); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewICNS(WithPadding()).AddFit(image.NewNRGBA(image.Rect(0, 0, 100, 60))); err != nil {
+		t.Error(err)
+	}
+}
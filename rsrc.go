@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/kroksys/icns/internal/rsrc"
+)
+
+// DecodeResourceFork loads the 'icns' resources of a classic Mac OS resource fork,
+// provided as is or within an AppleDouble ("._" companion) or AppleSingle file.
+func DecodeResourceFork(r io.Reader, opts ...DecodeOption) ([]*ICNS, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := readAll(r, o)
+	if err != nil {
+		return nil, err
+	}
+	fork, err := rsrc.Fork(data)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := rsrc.Decode(fork)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read resource fork: %w", err)
+	}
+
+	var res []*ICNS
+	for _, r := range resources {
+		if r.Type != magic {
+			continue
+		}
+		i, err := readICNS(r.Data, o)
+		if err != nil {
+			return nil, fmt.Errorf("icns resource %d: %w", r.ID, err)
+		}
+		res = append(res, i)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no icns resource found")
+	}
+	return res, nil
+}
+
+// CustomIconFile is the name of the file holding the custom icon of a folder, in its resource fork.
+const CustomIconFile = "Icon\r"
+
+// customIconID is the resource identifier of custom icons.
+const customIconID = -16455
+
+// CustomIconResourceFork returns the resource fork of the custom icon file of a folder,
+// holding the icon as an 'icns' resource. On macOS, the folder also needs its custom icon
+// Finder flag to be set, as done by SetFolderIcon.
+func CustomIconResourceFork(i *ICNS, opts ...EncodeOption) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, opts...); err != nil {
+		return nil, err
+	}
+	return rsrc.Encode([]rsrc.Resource{{
+		Type: magic,
+		ID:   customIconID,
+		Data: buf.Bytes(),
+	}}), nil
+}
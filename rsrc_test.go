@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/kroksys/icns/internal/rsrc"
+)
+
+// resourceFork builds a resource fork holding the provided resources, of a single type.
+func resourceFork(typ uint32, resources ...[]byte) []byte {
+	be := binary.BigEndian
+
+	data := new(bytes.Buffer)
+	refs := new(bytes.Buffer)
+	for idx, r := range resources {
+		binary.Write(refs, be, []uint16{uint16(128 + idx), 0xffff})
+		binary.Write(refs, be, []uint32{uint32(data.Len()), 0})
+		binary.Write(data, be, uint32(len(r)))
+		data.Write(r)
+	}
+
+	m := make([]byte, 28, 28+2+8+refs.Len())
+	be.PutUint16(m[24:], 28)             // type list offset
+	be.PutUint16(m[26:], uint16(cap(m))) // name list offset
+	m = be.AppendUint16(m, 0)            // one type
+	m = be.AppendUint32(m, typ)
+	m = be.AppendUint16(m, uint16(len(resources)-1))
+	m = be.AppendUint16(m, 2+8)
+	m = append(m, refs.Bytes()...)
+
+	hdr := make([]byte, 256)
+	be.PutUint32(hdr, 256)
+	be.PutUint32(hdr[4:], uint32(256+data.Len()))
+	be.PutUint32(hdr[8:], uint32(data.Len()))
+	be.PutUint32(hdr[12:], uint32(len(m)))
+	return append(append(hdr, data.Bytes()...), m...)
+}
+
+// appleDouble wraps a resource fork into an AppleDouble file.
+func appleDouble(fork []byte) []byte {
+	be := binary.BigEndian
+	hdr := make([]byte, 26+12)
+	be.PutUint32(hdr, 0x00051607)
+	be.PutUint32(hdr[4:], 0x00020000)
+	be.PutUint16(hdr[24:], 1)
+	be.PutUint32(hdr[26:], 2)
+	be.PutUint32(hdr[30:], uint32(len(hdr)))
+	be.PutUint32(hdr[34:], uint32(len(fork)))
+	return append(hdr, fork...)
+}
+
+func TestDecodeResourceFork(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("testdata/mit.icns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := new(bytes.Buffer)
+	if err := Encode(small, NewICNS()); err != nil {
+		t.Fatal(err)
+	}
+	fork := resourceFork(magic, data, small.Bytes())
+
+	for name, file := range map[string][]byte{
+		"resource fork": fork,
+		"AppleDouble":   appleDouble(fork),
+	} {
+		icons, err := DecodeResourceFork(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(icons) != 2 || len(icons[0].Assets) != 10 || len(icons[1].Assets) != 0 {
+			t.Errorf("%s: got %d unexpected icons", name, len(icons))
+		}
+	}
+
+	if _, err := DecodeResourceFork(bytes.NewReader(resourceFork('P'<<24|'I'<<16|'C'<<8|'T', data))); err == nil {
+		t.Error("expected an error without icns resources")
+	}
+	if _, err := DecodeResourceFork(bytes.NewReader(fork[:300])); err == nil {
+		t.Error("expected an error for a truncated resource fork")
+	}
+}
+
+func TestCustomIconResourceFork(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fork, err := CustomIconResourceFork(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := rsrc.Decode(fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 || resources[0].Type != magic || resources[0].ID != customIconID {
+		t.Fatalf("unexpected resources: %v", resources)
+	}
+
+	icons, err := DecodeResourceFork(bytes.NewReader(fork))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(icons) != 1 || len(icons[0].Assets) != len(i.Assets) {
+		t.Errorf("unexpected icons in the resource fork")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Geometry of the macOS Big Sur icon template, relative to a 1024px canvas.
+const (
+	squircleBody     = 824  // size of the rounded shape
+	squircleExponent = 5    // superellipse exponent approximating the continuous corners
+	shadowOffset     = 12   // vertical offset of the drop shadow
+	shadowBlur       = 28   // blur radius of the drop shadow
+	shadowOpacity    = 0.3  // opacity of the drop shadow
+	templateSize     = 1024 // size of the template canvas
+)
+
+// Squircle composites artwork into the macOS Big Sur rounded shape, with its margins
+// and, optionally, its drop shadow, at the provided resolution.
+// The artwork is scaled to fill the shape, and clipped to it.
+func Squircle(art image.Image, r Resolution, shadow bool) image.Image {
+	return NewICNS().squircle(art, r, shadow)
+}
+
+// FromArtwork creates an icon made of the artwork composited into the macOS Big Sur
+// rounded shape, rendered at every resolution supported within the compatibility range
+// set by the options.
+func FromArtwork(art image.Image, shadow bool, opts ...Option) (*ICNS, error) {
+	i := NewICNS(opts...)
+
+	resolutions := SupportedResolutions(i.minCompat, i.maxCompat)
+	if len(resolutions) == 0 {
+		return nil, ErrUnsupportedResolution
+	}
+
+	art = i.square(art)
+	for _, r := range resolutions {
+		if err := i.Add(i.squircle(art, r, shadow)); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+func (i *ICNS) squircle(art image.Image, r Resolution, shadow bool) image.Image {
+	size := float64(r)
+	scale := size / templateSize
+	body := squircleBody * scale
+	origin := (size - body) / 2
+
+	mask := squircleMask(int(r), origin, body)
+	dst := image.NewNRGBA(image.Rect(0, 0, int(r), int(r)))
+
+	if shadow {
+		s := blurAlpha(mask, shadowBlur*scale)
+		off := int(math.Round(shadowOffset * scale))
+		c := image.NewUniform(color.NRGBA{A: uint8(math.Round(shadowOpacity * 0xff))})
+		draw.DrawMask(dst, dst.Bounds().Add(image.Pt(0, off)), c, image.Point{}, s, image.Point{}, draw.Src)
+	}
+
+	// scale the artwork to the bounding box of the shape
+	lo, hi := int(math.Floor(origin)), int(math.Ceil(origin+body))
+	scaled := image.NewNRGBA(image.Rect(lo, lo, hi, hi))
+	s := i.scaler
+	if s == nil {
+		s = defaultScaler
+	}
+	s.Scale(scaled, art)
+
+	draw.DrawMask(dst, scaled.Bounds(), scaled, scaled.Bounds().Min, mask, scaled.Bounds().Min, draw.Over)
+	return dst
+}
+
+// squircleMask returns the antialiased coverage of a superellipse with the provided
+// origin and size, on a square canvas.
+func squircleMask(size int, origin, body float64) *image.Alpha {
+	const samples = 4
+
+	mask := image.NewAlpha(image.Rect(0, 0, size, size))
+	half := body / 2
+	center := origin + half
+	cover := make([]float64, size)
+	for y := 0; y < size; y++ {
+		for x := range cover {
+			cover[x] = 0
+		}
+		for sy := 0; sy < samples; sy++ {
+			v := math.Abs(float64(y)+(float64(sy)+0.5)/samples-center) / half
+			if v >= 1 {
+				continue
+			}
+			// horizontal extent of the shape on this line
+			e := half * math.Pow(1-math.Pow(v, squircleExponent), 1.0/squircleExponent)
+			left, right := center-e, center+e
+			for x := int(left); x < size && float64(x) < right; x++ {
+				c := math.Min(float64(x+1), right) - math.Max(float64(x), left)
+				if c > 0 {
+					cover[x] += c / samples
+				}
+			}
+		}
+		for x, c := range cover {
+			mask.Pix[y*mask.Stride+x] = uint8(math.Round(math.Min(c, 1) * 0xff))
+		}
+	}
+	return mask
+}
+
+// blurAlpha approximates a gaussian blur of the provided radius with three box blurs.
+func blurAlpha(src *image.Alpha, radius float64) *image.Alpha {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	buf := make([]float64, w*h)
+	for idx := range buf {
+		buf[idx] = float64(src.Pix[idx])
+	}
+
+	box := int(math.Round(radius / 3))
+	if box > 0 {
+		tmp := make([]float64, w*h)
+		for pass := 0; pass < 3; pass++ {
+			boxBlur(tmp, buf, w, h, box, 1, w) // horizontal
+			boxBlur(buf, tmp, h, w, box, w, 1) // vertical
+		}
+	}
+
+	res := image.NewAlpha(b)
+	for idx, v := range buf {
+		res.Pix[idx] = uint8(math.Round(math.Min(math.Max(v, 0), 0xff)))
+	}
+	return res
+}
+
+// boxBlur averages src over windows of 2*r+1 values along lines of length n,
+// which are lines count apart. step is the distance between the values of a line,
+// and stride the distance between lines.
+func boxBlur(dst, src []float64, n, lines, r, step, stride int) {
+	norm := 1 / float64(2*r+1)
+	for l := 0; l < lines; l++ {
+		base := l * stride
+		var sum float64
+		for k := -r; k <= r; k++ {
+			if k >= 0 && k < n {
+				sum += src[base+k*step]
+			}
+		}
+		for k := 0; k < n; k++ {
+			dst[base+k*step] = sum * norm
+			if out := k - r; out >= 0 {
+				sum -= src[base+out*step]
+			}
+			if in := k + r + 1; in < n {
+				sum += src[base+in*step]
+			}
+		}
+	}
+}
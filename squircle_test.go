@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSquircle(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for idx := 0; idx < len(src.Pix); idx += 4 {
+		copy(src.Pix[idx:], []byte{0xff, 0, 0, 0xff})
+	}
+
+	alpha := func(img image.Image, x, y int) uint8 {
+		return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA).A
+	}
+
+	img := Squircle(src, Pixel1024, false)
+	if b := img.Bounds(); b.Dx() != 1024 || b.Dy() != 1024 {
+		t.Fatalf("got %dx%d image", b.Dx(), b.Dy())
+	}
+	if c := color.NRGBAModel.Convert(img.At(512, 512)); c != (color.NRGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("unexpected color at the center: %v", c)
+	}
+	for _, p := range []image.Point{{0, 0}, {50, 512}, {512, 1000}, {105, 105}} {
+		if a := alpha(img, p.X, p.Y); a != 0 {
+			t.Errorf("%v: unexpected alpha %#x outside of the shape", p, a)
+		}
+	}
+	if a := alpha(img, 101, 512); a != 0xff {
+		t.Errorf("unexpected alpha %#x on the edge of the shape", a)
+	}
+
+	shadow := Squircle(src, Pixel1024, true)
+	if a := alpha(shadow, 512, 930); a == 0 {
+		t.Error("no shadow below the shape")
+	}
+	if a := alpha(shadow, 512, 80); a != 0 {
+		t.Errorf("unexpected shadow above the shape: %#x", a)
+	}
+
+	i, err := FromArtwork(src, true, WithMinCompatibility(Lion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range i.Assets {
+		if b := a.Image.Bounds(); b.Dx() != int(a.Format.Res) {
+			t.Errorf("[%s] got %dpx image", CodeString(a.Format.Code), b.Dx())
+		}
+		if alpha(a.Image, 0, 0) != 0 {
+			t.Errorf("[%s] no margin", CodeString(a.Format.Code))
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/kroksys/icns/internal/binary"
+)
+
+// WithStreaming makes Decode read the file one element at a time, up to the size
+// announced in its header, rather than reading all of r into memory first. Beyond the
+// elements kept by the icon, memory use is then bounded by the size of a single element,
+// and r is not read past the end of the icon, which suits network streams.
+func WithStreaming() DecodeOption {
+	return func(o *decodeOptions) {
+		o.streaming = true
+	}
+}
+
+// decodeStream implements Decode with WithStreaming.
+func decodeStream(r io.Reader, o decodeOptions) (*ICNS, error) {
+	s, err := newChunkScanner(r, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	var offsets []int
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		data, err := s.data()
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, int(s.offset))
+		chunks = append(chunks, Chunk{Code: s.code, Data: data})
+	}
+	return decodeChunks(chunks, offsets, o, s.lim)
+}
+
+// chunkScanner reads the elements of a file one at a time, without buffering the file.
+type chunkScanner struct {
+	r   io.Reader
+	lim *limiter
+
+	total   int64 // size of the file, from its header
+	offset  int64 // offset of the current element header
+	code    uint32
+	size    int64 // size of the current element, including its header
+	pending int64 // bytes of the current element not read yet
+}
+
+// newChunkScanner reads the header of the file.
+func newChunkScanner(r io.Reader, o decodeOptions) (*chunkScanner, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("cannot read ICNS header: %w", eofErr(err))
+	}
+	hdr := binary.Reader(buf)
+	if m, _ := hdr.Uint32(); m != magic {
+		return nil, fmt.Errorf("wrong magic number for ICNS file: %x", m)
+	}
+	total, _ := hdr.Uint32()
+	if total < 8 {
+		return nil, fmt.Errorf("invalid ICNS file size %d", total)
+	}
+	if max := o.limits.MaxFileSize; max > 0 && int64(total) > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: int64(total), Max: max}
+	}
+	return &chunkScanner{
+		r:      r,
+		lim:    &limiter{Limits: o.limits},
+		total:  int64(total),
+		offset: 8,
+	}, nil
+}
+
+// next moves to the next element, skipping what was not read of the current one.
+// It returns false at the end of the file.
+func (s *chunkScanner) next() (bool, error) {
+	if err := s.skip(); err != nil {
+		return false, err
+	}
+	s.offset += s.size
+	s.code, s.size = 0, 0
+	if s.offset >= s.total {
+		return false, nil
+	}
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return false, fmt.Errorf("cannot read element header at offset %d: %w", s.offset, eofErr(err))
+	}
+	hdr := binary.Reader(buf)
+	code, _ := hdr.Uint32()
+	size, _ := hdr.Uint32()
+	if available := s.total - s.offset; size < 8 || int64(size) > available {
+		return false, &ChunkSizeError{
+			Code:      code,
+			Offset:    int(s.offset),
+			Declared:  int(size),
+			Available: int(available),
+		}
+	}
+	if err := s.lim.chunk(code, int(s.offset), int(size)); err != nil {
+		return false, err
+	}
+	s.code, s.size, s.pending = code, int64(size), int64(size)-8
+	return true, nil
+}
+
+// data reads the content of the current element.
+func (s *chunkScanner) data() ([]byte, error) {
+	data := make([]byte, s.pending)
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		return nil, &ChunkError{Code: s.code, Offset: int(s.offset), Err: eofErr(err)}
+	}
+	s.pending = 0
+	return data, nil
+}
+
+// skip discards the rest of the current element.
+func (s *chunkScanner) skip() error {
+	if s.pending == 0 {
+		return nil
+	}
+	var err error
+	if sk, ok := s.r.(io.Seeker); ok {
+		_, err = sk.Seek(s.pending, io.SeekCurrent)
+	} else {
+		var n int64
+		n, err = io.CopyN(io.Discard, s.r, s.pending)
+		if err == nil && n < s.pending {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		return &ChunkError{Code: s.code, Offset: int(s.offset), Err: eofErr(err)}
+	}
+	s.pending = 0
+	return nil
+}
+
+// eofErr reports the end of the input as io.ErrUnexpectedEOF, as the decoding of a byte slice does.
+func eofErr(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig returns the size of the highest resolution image of the .icns file in r,
+// from the headers of its elements only.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	res, err := Resolutions(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if len(res) == 0 {
+		return image.Config{}, ErrNoImage
+	}
+	max := res[len(res)-1]
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(max),
+		Height:     int(max),
+	}, nil
+}
+
+// Resolutions returns the resolutions of the images of the .icns file in r, in increasing
+// order, from the headers of its elements only.
+func Resolutions(r io.Reader) ([]Resolution, error) {
+	s, err := newChunkScanner(r, decodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[Resolution]bool)
+	var res []Resolution
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if f, ok := supportedImageFormats[s.code]; ok && !found[f.Res] {
+			found[f.Res] = true
+			res = append(res, f.Res)
+		}
+	}
+	sort.Slice(res, func(x, y int) bool { return res[x] < res[y] })
+	return res, nil
+}
+
+// DecodeResolution decodes only an image of the provided resolution from r, reading
+// the file up to the first element holding one and skipping the data of the others.
+// Modern formats are preferred to legacy ones, which are only used when the file
+// contains no other image of that resolution.
+func DecodeResolution(r io.Reader, res Resolution, opts ...DecodeOption) (image.Image, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s, err := newChunkScanner(r, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode returns the image of the current element, or nil if it is to be skipped.
+	decode := func(f *Format, offset int, data []byte) (image.Image, error) {
+		if err := s.lim.decode(f, offset, data); err != nil {
+			return nil, err
+		}
+		d := o.decodeImage(f, data)
+		err, kind := d.err, DiagnosticCodecError
+		if err == nil {
+			if b := d.img.Bounds(); o.dimensions != DimensionsKeep && (b.Dx() != int(res) || b.Dy() != int(res)) {
+				err = fmt.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), res, res)
+				kind = DiagnosticDimensionMismatch
+			}
+		}
+		if err != nil {
+			if o.strict {
+				return nil, &ChunkError{Code: f.Code, Offset: offset, Err: err}
+			}
+			o.diag.add(kind, f.Code, offset, err)
+			return nil, nil
+		}
+		return d.img, nil
+	}
+
+	// legacy images and masks, kept until a better image is found
+	var legacy *Format
+	var legacyOffset int
+	var legacyData []byte
+	masks := make(map[uint32][]byte)
+	maskOffsets := make(map[uint32]int)
+
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		if mf, ok := supportedMaskFormats[s.code]; ok && mf.Res == res {
+			if _, seen := masks[s.code]; !seen {
+				if masks[s.code], err = s.data(); err != nil {
+					return nil, err
+				}
+				maskOffsets[s.code] = int(s.offset)
+			}
+			continue
+		}
+		f, ok := supportedImageFormats[s.code]
+		if !ok || f.Res != res {
+			continue
+		}
+		data, err := s.data()
+		if err != nil {
+			return nil, err
+		}
+		if f.CombineCode != 0 {
+			if legacy == nil {
+				legacy, legacyOffset, legacyData = f, int(s.offset), data
+			}
+			continue
+		}
+		img, err := decode(f, int(s.offset), data)
+		if err != nil || img != nil {
+			return img, err
+		}
+	}
+
+	if legacy == nil {
+		return nil, ErrNoSuchResolution
+	}
+	img, err := decode(legacy, legacyOffset, legacyData)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return nil, ErrNoSuchResolution
+	}
+	if data, ok := masks[legacy.CombineCode]; ok && !o.noComposit {
+		mf := supportedMaskFormats[legacy.CombineCode]
+		if err := s.lim.decode(mf, maskOffsets[mf.Code], data); err != nil {
+			return nil, err
+		}
+		if m := o.decodeImage(mf, data); m.err == nil {
+			img = composite(img, m.img, res)
+		}
+	}
+	return img, nil
+}
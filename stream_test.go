@@ -0,0 +1,158 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestDecodeResolution(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	draw.Draw(src, image.Rect(0, 0, 64, 128), image.NewUniform(color.NRGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+	i, err := FromImage(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// the file is read up to the ic07 element: it32 comes first, then ic07
+	end := bytes.Index(data, []byte("ic07"))
+	size := int(data[end+4])<<24 | int(data[end+5])<<16 | int(data[end+6])<<8 | int(data[end+7])
+	truncated := io.MultiReader(bytes.NewReader(data[:end+size])) // not an io.Seeker
+	got, err := DecodeResolution(truncated, Pixel128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := i.ByCode(CodeIc07)
+	if !utils.EqualImages(got, want.Image) {
+		t.Error("unexpected 128px image")
+	}
+
+	for _, r := range []Resolution{Pixel16, Pixel32, Pixel48, Pixel1024} {
+		got, err := DecodeResolution(bytes.NewReader(data), r)
+		if err != nil {
+			t.Fatalf("%dpx: %v", r, err)
+		}
+		if b := got.Bounds(); b.Dx() != int(r) {
+			t.Errorf("%dpx: got %dpx image", r, b.Dx())
+		}
+	}
+
+	// legacy images are composited with their mask
+	legacy := NewICNS(WithMaxCompatibility(Allegro))
+	if err := legacy.Add(utils.CloneImage(src)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := Encode(buf, legacy); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLegacy, err := d.ByResolution(Pixel128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = DecodeResolution(bytes.NewReader(buf.Bytes()), Pixel128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utils.EqualImages(got, wantLegacy) {
+		t.Error("unexpected legacy image")
+	}
+
+	if _, err := DecodeResolution(bytes.NewReader(buf.Bytes()), Pixel1024); err == nil {
+		t.Error("expected an error for a missing resolution")
+	}
+	if _, err := DecodeResolution(bytes.NewReader(data[:len(data)-1]), Pixel1024); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+
+	// an image of the wrong size is reported as such
+	small := new(bytes.Buffer)
+	if err := png.Encode(small, image.NewNRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	var diag Diagnostics
+	mismatch := rawICNS(t, Chunk{Code: CodeIc07, Data: small.Bytes()})
+	if _, err := DecodeResolution(bytes.NewReader(mismatch), Pixel128, WithDiagnostics(&diag)); err == nil {
+		t.Error("expected an error for an image of the wrong size")
+	}
+	if len(diag.Entries) != 1 || diag.Entries[0].Kind != DiagnosticDimensionMismatch {
+		t.Errorf("unexpected diagnostics:\n%s", diag.String())
+	}
+}
+
+// failingReader fails every read.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read past the end of the icon")
+}
+
+func TestWithStreaming(t *testing.T) {
+	t.Parallel()
+	data, err := ioutil.ReadAll(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := io.MultiReader(bytes.NewReader(data), failingReader{})
+	if _, err := Decode(r); err == nil {
+		t.Fatal("expected Decode to read past the end of the icon")
+	}
+	r = io.MultiReader(bytes.NewReader(data), failingReader{})
+	got, err := Decode(r, WithStreaming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Info(), got.Info()); diff != "" {
+		t.Errorf("unexpected icon (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want.RawChunks(), got.RawChunks()); diff != "" {
+		t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+	}
+
+	for n := 0; n < len(data); n += 997 {
+		if _, err := Decode(bytes.NewReader(data[:n]), WithStreaming()); err == nil {
+			t.Errorf("%d bytes: expected an error for a truncated file", n)
+		}
+	}
+	if _, err := Decode(bytes.NewReader(data), WithStreaming(), WithLimits(Limits{MaxFileSize: 100})); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/kroksys/icns/internal/binary"
+)
+
+// element locates an element in a file.
+type element struct {
+	offset int64 // offset of the element header
+	size   int64 // size of the element, including its header
+}
+
+// DecodeImageAt decodes only the image stored under code in the .icns file of the
+// provided size read from r, along with its mask for legacy formats. When the file
+// starts with a table of contents, the element is located from it instead of walking
+// the headers of all the elements before it.
+func DecodeImageAt(r io.ReaderAt, size int64, code uint32, opts ...DecodeOption) (*Img, error) {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if max := o.limits.MaxFileSize; max > 0 && size > max {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: size, Max: max}
+	}
+
+	f, ok := supportedImageFormats[code]
+	if !ok {
+		return nil, &UnsupportedChunkError{Code: code}
+	}
+	codes := []uint32{code}
+	if f.CombineCode != 0 {
+		codes = append(codes, f.CombineCode)
+	}
+	elems, err := findElements(r, size, codes...)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := elems[code]
+	if !ok {
+		return nil, fmt.Errorf("no %s element in the file: %w", CodeString(code), ErrNoSuchResolution)
+	}
+
+	lim := &limiter{Limits: o.limits}
+	read := func(code uint32, e element) ([]byte, error) {
+		if err := lim.chunk(code, int(e.offset), int(e.size)); err != nil {
+			return nil, err
+		}
+		data := make([]byte, e.size-8)
+		if err := readAt(r, data, e.offset+8); err != nil {
+			return nil, &ChunkError{Code: code, Offset: int(e.offset), Err: err}
+		}
+		return data, nil
+	}
+
+	var mask image.Image
+	if me, ok := elems[f.CombineCode]; ok && f.CombineCode != 0 {
+		mf := supportedMaskFormats[f.CombineCode]
+		data, err := read(mf.Code, me)
+		if err != nil {
+			return nil, err
+		}
+		if err := lim.decode(mf, int(me.offset), data); err != nil {
+			return nil, err
+		}
+		d := o.decodeImage(mf, data)
+		if d.err != nil {
+			return nil, &ChunkError{Code: mf.Code, Offset: int(me.offset), Err: d.err}
+		}
+		mask = d.img
+	}
+
+	data, err := read(code, e)
+	if err != nil {
+		return nil, err
+	}
+	if err := lim.decode(f, int(e.offset), data); err != nil {
+		return nil, err
+	}
+	d := o.decodeImage(f, data)
+	if d.err != nil {
+		return nil, &ChunkError{Code: code, Offset: int(e.offset), Err: d.err}
+	}
+	img := d.img
+	if b := img.Bounds(); o.dimensions != DimensionsKeep && (b.Dx() != int(f.Res) || b.Dy() != int(f.Res)) {
+		err := fmt.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), f.Res, f.Res)
+		return nil, &ChunkError{Code: code, Offset: int(e.offset), Err: err}
+	}
+	if mask != nil && !o.noComposit {
+		img = composite(img, mask, f.Res)
+	}
+
+	return &Img{
+		Image:   img,
+		Format:  f,
+		Encoder: d.enc,
+		Data:    data,
+		mask:    mask,
+		src:     img,
+		stored:  dataEncoding(d.enc, data),
+	}, nil
+}
+
+// findElements returns the location of the first element of each of the provided
+// codes, using the table of contents of the file when there is a valid one.
+func findElements(r io.ReaderAt, size int64, codes ...uint32) (map[uint32]element, error) {
+	buf := make([]byte, 8)
+	if err := readAt(r, buf, 0); err != nil {
+		return nil, fmt.Errorf("cannot read ICNS header: %w", err)
+	}
+	hdr := binary.Reader(buf)
+	if m, _ := hdr.Uint32(); m != magic {
+		return nil, fmt.Errorf("wrong magic number for ICNS file: %x", m)
+	}
+
+	wanted := make(map[uint32]bool)
+	for _, c := range codes {
+		wanted[c] = true
+	}
+
+	if res, ok := findInTOC(r, size, wanted); ok {
+		return res, nil
+	}
+
+	res := make(map[uint32]element)
+	for offset := int64(8); offset < size && len(res) < len(wanted); {
+		if err := readAt(r, buf, offset); err != nil {
+			return nil, fmt.Errorf("cannot read element header at offset %d: %w", offset, err)
+		}
+		hdr := binary.Reader(buf)
+		code, _ := hdr.Uint32()
+		chunkSize, _ := hdr.Uint32()
+		if chunkSize < 8 || int64(chunkSize) > size-offset {
+			return nil, &ChunkSizeError{
+				Code:      code,
+				Offset:    int(offset),
+				Declared:  int(chunkSize),
+				Available: int(size - offset),
+			}
+		}
+		if _, ok := res[code]; wanted[code] && !ok {
+			res[code] = element{offset: offset, size: int64(chunkSize)}
+		}
+		offset += int64(chunkSize)
+	}
+	return res, nil
+}
+
+// findInTOC locates the wanted elements from the table of contents of the file.
+// It reports false when there is no table of contents, when it does not match
+// the headers of the elements it locates, or when it misses some of them.
+func findInTOC(r io.ReaderAt, size int64, wanted map[uint32]bool) (map[uint32]element, bool) {
+	buf := make([]byte, 8)
+	if readAt(r, buf, 8) != nil {
+		return nil, false
+	}
+	hdr := binary.Reader(buf)
+	code, _ := hdr.Uint32()
+	tocSize, _ := hdr.Uint32()
+	if code != CodeTOC || tocSize < 8 || int64(tocSize) > size-8 || (tocSize-8)%8 != 0 {
+		return nil, false
+	}
+	toc := make([]byte, tocSize-8)
+	if readAt(r, toc, 16) != nil {
+		return nil, false
+	}
+
+	res := make(map[uint32]element)
+	entries := binary.Reader(toc)
+	offset := 8 + int64(tocSize)
+	for len(entries) > 0 {
+		code, _ := entries.Uint32()
+		chunkSize, _ := entries.Uint32()
+		if chunkSize < 8 || int64(chunkSize) > size-offset {
+			return nil, false
+		}
+		if _, ok := res[code]; wanted[code] && !ok {
+			// check the header, in case the table is out of date
+			if readAt(r, buf, offset) != nil {
+				return nil, false
+			}
+			hdr := binary.Reader(buf)
+			if c, _ := hdr.Uint32(); c != code {
+				return nil, false
+			}
+			if s, _ := hdr.Uint32(); s != chunkSize {
+				return nil, false
+			}
+			res[code] = element{offset: offset, size: int64(chunkSize)}
+		}
+		offset += int64(chunkSize)
+	}
+	// the element may still be present, if the table is incomplete
+	return res, len(res) == len(wanted)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kroksys/icns/internal/utils"
+)
+
+// countingReaderAt counts the calls to ReadAt.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	calls int32
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.r.ReadAt(p, off)
+}
+
+func TestDecodeImageAt(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, withTOC := new(bytes.Buffer), new(bytes.Buffer)
+	if err := Encode(plain, i); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(withTOC, i, WithTOC()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		reads int32 // maximum number of reads
+	}{
+		{"plain", plain.Bytes(), 100},
+		{"toc", withTOC.Bytes(), 5},
+	} {
+		for _, a := range i.Assets {
+			r := &countingReaderAt{r: bytes.NewReader(tc.data)}
+			got, err := DecodeImageAt(r, int64(len(tc.data)), a.Format.Code)
+			if err != nil {
+				t.Fatalf("%s: [%s] %v", tc.name, CodeString(a.Format.Code), err)
+			}
+			if !utils.EqualImages(got.Image, a.Image) {
+				t.Errorf("%s: [%s] unexpected image", tc.name, CodeString(a.Format.Code))
+			}
+			if !bytes.Equal(got.Data, a.Data) {
+				t.Errorf("%s: [%s] unexpected data", tc.name, CodeString(a.Format.Code))
+			}
+			if a.Format.CombineCode == 0 && r.calls > tc.reads {
+				t.Errorf("%s: [%s] %d reads, want at most %d", tc.name, CodeString(a.Format.Code), r.calls, tc.reads)
+			}
+		}
+
+		if _, err := DecodeImageAt(bytes.NewReader(tc.data), int64(len(tc.data)), CodeIcp4); err == nil {
+			t.Errorf("%s: expected an error for a missing element", tc.name)
+		}
+	}
+
+	if _, err := DecodeImageAt(bytes.NewReader(plain.Bytes()), int64(plain.Len()), CodeTOC); err == nil {
+		t.Error("expected an error for an unsupported code")
+	}
+
+	// an out of date table of contents is ignored
+	stale := append([]byte(nil), withTOC.Bytes()...)
+	stale[23]++ // size of the first element listed by the table
+	got, err := DecodeImageAt(bytes.NewReader(stale), int64(len(stale)), CodeIc07)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := i.ByCode(CodeIc07); !bytes.Equal(got.Data, want.Data) {
+		t.Error("unexpected data with a stale table of contents")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"fmt"
+	"image"
+)
+
+// Severity classifies the findings of Validate.
+type Severity int
+
+const (
+	// SeverityWarning reports a recommendation of the profile that is not followed.
+	SeverityWarning Severity = iota
+	// SeverityError reports a requirement of the profile that is not met.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Finding is a single problem reported by Validate.
+type Finding struct {
+	Severity Severity
+	Code     uint32 // code of the offending image, 0 for problems of the whole icon
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Code == 0 {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s", f.Severity, CodeString(f.Code), f.Message)
+}
+
+// Size is the logical size of an image, displayed at PointSize points with Scale
+// pixels per point, as described by Format.
+type Size struct {
+	PointSize uint
+	Scale     uint
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%dpt@%dx (%dpx)", s.PointSize, s.Scale, s.PointSize*s.Scale)
+}
+
+// Profile lists the requirements checked by Validate. Whatever the profile, images
+// must be square and match the resolution of their format.
+type Profile struct {
+	Name string
+	// Required lists the sizes the icon must hold an image for, in any format.
+	Required []Size
+	// Recommended lists the sizes whose absence is reported as a warning.
+	Recommended []Size
+	// Alpha reports images without any transparent pixel, such as JPEG ones, as warnings.
+	Alpha bool
+}
+
+// iconsetSizes are the sizes of the files of an .iconset directory.
+var iconsetSizes = []Size{
+	{16, 1}, {16, 2}, {32, 1}, {32, 2}, {128, 1}, {128, 2}, {256, 1}, {256, 2}, {512, 1}, {512, 2},
+}
+
+var (
+	// AppStoreSubmission requires every size produced by iconutil, up to 1024px
+	// for 512pt@2x, with transparent margins.
+	AppStoreSubmission = Profile{
+		Name:     "App Store submission",
+		Required: iconsetSizes,
+		Alpha:    true,
+	}
+
+	// FinderMinimum requires the sizes displayed by Finder at 1x, and recommends
+	// the other sizes produced by iconutil.
+	FinderMinimum = Profile{
+		Name:        "Finder minimum",
+		Required:    []Size{{16, 1}, {32, 1}, {128, 1}},
+		Recommended: []Size{{16, 2}, {32, 2}, {128, 2}, {256, 1}, {256, 2}, {512, 1}, {512, 2}},
+	}
+
+	// SidebarIcon requires the small sizes displayed in the sidebar of Finder, with
+	// transparent backgrounds.
+	SidebarIcon = Profile{
+		Name:     "sidebar icon",
+		Required: []Size{{16, 1}, {16, 2}, {32, 1}, {32, 2}},
+		Alpha:    true,
+	}
+)
+
+// Validate checks the icon against the profile, returning its findings, or nil if it
+// complies: the missing sizes first, then the problems of each image. Lazily decoded
+// images are decoded.
+func (i *ICNS) Validate(p Profile) []Finding {
+	var res []Finding
+	add := func(s Severity, code uint32, format string, args ...interface{}) {
+		res = append(res, Finding{Severity: s, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	has := make(map[Size]bool)
+	for _, a := range i.Assets {
+		has[Size{a.Format.PointSize, a.Format.Scale}] = true
+	}
+	for _, s := range p.Required {
+		if !has[s] {
+			add(SeverityError, 0, "missing %s image", s)
+		}
+	}
+	for _, s := range p.Recommended {
+		if !has[s] {
+			add(SeverityWarning, 0, "missing %s image", s)
+		}
+	}
+
+	for _, a := range i.Assets {
+		img, err := a.AsImage()
+		if err != nil {
+			add(SeverityError, a.Format.Code, "%v", err)
+			continue
+		}
+		b := img.Bounds()
+		switch r := int(a.Format.Res); {
+		case b.Dx() != b.Dy():
+			add(SeverityError, a.Format.Code, "image is not a square: %dx%d", b.Dx(), b.Dy())
+			continue
+		case b.Dx() != r:
+			add(SeverityError, a.Format.Code, "image is %dx%d, want %dx%d", b.Dx(), b.Dy(), r, r)
+			continue
+		}
+		if p.Alpha && opaque(img) {
+			add(SeverityWarning, a.Format.Code, "image has no transparent pixel")
+		}
+	}
+	return res
+}
+
+// opaque reports whether every pixel of the image is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
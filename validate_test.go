@@ -0,0 +1,68 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Profile{AppStoreSubmission, FinderMinimum, SidebarIcon} {
+		if got := i.Validate(p); got != nil {
+			t.Errorf("%s: unexpected findings: %v", p.Name, got)
+		}
+	}
+
+	i.RemoveByCode(CodeIc10)
+	opaque := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for _, a := range i.Assets {
+		switch a.Format.Code {
+		case CodeIc05:
+			a.Image = opaque
+		case CodeIc07:
+			a.Image = image.NewNRGBA(image.Rect(0, 0, 128, 64))
+		case CodeIc08:
+			a.Image = image.NewNRGBA(image.Rect(0, 0, 128, 128))
+		}
+	}
+
+	var got []string
+	for _, f := range i.Validate(AppStoreSubmission) {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"error: missing 512pt@2x (1024px) image",
+		"error: [ic07] image is not a square: 128x64",
+		"error: [ic08] image is 128x128, want 256x256",
+		"warning: [ic05] image has no transparent pixel",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Validate() mismatch (-want +got):\n%s", diff)
+	}
+	if got := i.Validate(FinderMinimum); len(got) != 3 || got[0].Severity != SeverityWarning {
+		t.Errorf("FinderMinimum: unexpected findings: %v", got)
+	}
+}
@@ -16,65 +16,565 @@ package icns
 
 import (
 	"bytes"
+	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"math"
+	"sort"
 
+	"github.com/kroksys/icns/codec"
 	"github.com/kroksys/icns/internal/binary"
 	"github.com/kroksys/icns/internal/utils"
 )
 
+// EncodeOption is the type for Encode options.
+type EncodeOption func(*encodeOptions)
+
+type encodeOptions struct {
+	preserveUnknown bool
+	jpegQuality     int
+	pngLevel        png.CompressionLevel
+	pngEncoder      *png.Encoder
+	pngFormat       codec.ImageFormat
+	jpegFormat      codec.ImageFormat
+	toc             bool
+	dedup           bool
+	window          bool
+	minCompat       Compatibility
+	maxCompat       Compatibility
+	maxSize         int64
+	dropped         *[]uint32
+	parallelism     int
+
+	// buffers reused by an Encoder
+	pngPool png.EncoderBufferPool
+	scratch map[uint32]*image.NRGBA
+}
+
+// WithMaxFileSize drops redundant images until the file fits in n bytes, and fails
+// with a *LimitError when it still does not. Legacy images available in a modern format
+// are dropped first, then images available at the same pixel size for a smaller point size.
+// The codes of the dropped images are appended to dropped, when not nil.
+func WithMaxFileSize(n int64, dropped *[]uint32) EncodeOption {
+	return func(o *encodeOptions) {
+		o.maxSize = n
+		o.dropped = dropped
+	}
+}
+
+// WithCompatibility writes only the images whose format is compatible with the
+// provided range of OS versions, along with the raw elements added for them.
+// For instance, WithCompatibility(Lion, Newest) omits the legacy formats.
+func WithCompatibility(min, max Compatibility) EncodeOption {
+	return func(o *encodeOptions) {
+		o.window = true
+		o.minCompat = min
+		o.maxCompat = max
+	}
+}
+
+// excluded reports whether the format is outside the compatibility range of the options.
+func (o *encodeOptions) excluded(f *Format) bool {
+	return o.window && (f.Compat < o.minCompat || f.Compat > o.maxCompat)
+}
+
+// excludedCode reports whether the code, of an image or mask, only belongs
+// to formats outside the compatibility range of the options.
+func (o *encodeOptions) excludedCode(code uint32) bool {
+	var found bool
+	for _, f := range supportedImageFormats {
+		if f.Code == code || f.CombineCode == code {
+			if !o.excluded(f) {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// WithDeduplication encodes only once the images that have the same pixels and encoding,
+// such as ic11 (16pt@2x) and icp5 (32pt@1x), reusing the same data for all their elements.
+func WithDeduplication() EncodeOption {
+	return func(o *encodeOptions) {
+		o.dedup = true
+	}
+}
+
+// WithTOC writes a table of contents listing all the elements of the file, as iconutil does.
+func WithTOC() EncodeOption {
+	return func(o *encodeOptions) {
+		o.toc = true
+	}
+}
+
+// WithJPEGQuality sets the quality, from 1 to 100, of the images stored as JPEG.
+func WithJPEGQuality(q int) EncodeOption {
+	return func(o *encodeOptions) {
+		o.jpegQuality = q
+	}
+}
+
+// WithPNGCompression sets the compression level of the images stored as PNG.
+func WithPNGCompression(level png.CompressionLevel) EncodeOption {
+	return func(o *encodeOptions) {
+		o.pngLevel = level
+	}
+}
+
+// WithPNGEncoder encodes the images stored as PNG with e, for instance to share
+// a BufferPool across calls to Encode. It takes precedence over WithPNGCompression.
+func WithPNGEncoder(e *png.Encoder) EncodeOption {
+	return func(o *encodeOptions) {
+		o.pngEncoder = e
+	}
+}
+
+// WithImageEncoders replaces the PNG and JPEG encoders of the standard library,
+// unless nil, for instance with faster implementations. They take precedence over
+// WithPNGCompression and WithJPEGQuality.
+func WithImageEncoders(pngFormat, jpegFormat codec.ImageFormat) EncodeOption {
+	return func(o *encodeOptions) {
+		o.pngFormat = pngFormat
+		o.jpegFormat = jpegFormat
+	}
+}
+
+// tune applies the encoder settings to the default image codecs.
+func (o *encodeOptions) tune(c codec.Codec) codec.Codec {
+	if c != codec.ImageCodec && c != codec.JPEGCodec {
+		return c
+	}
+	p, j := o.pngFormat, o.jpegFormat
+	switch {
+	case p == nil && o.pngEncoder != nil:
+		p = codec.PNG(o.pngEncoder)
+	case p == nil && (o.pngLevel != png.DefaultCompression || o.pngPool != nil):
+		p = codec.PNG(&png.Encoder{CompressionLevel: o.pngLevel, BufferPool: o.pngPool})
+	}
+	if j == nil && o.jpegQuality > 0 {
+		j = codec.JPEG(o.jpegQuality)
+	}
+	switch {
+	case p == nil && j == nil:
+		return c
+	case c == codec.JPEGCodec:
+		return codec.JPEGFormatCodec(p, j)
+	}
+	return codec.PNGFormatCodec(p, j)
+}
+
+// nrgba converts img, stored under code, to an NRGBA image, reusing the scratch
+// images of an Encoder.
+func (o *encodeOptions) nrgba(code uint32, img image.Image) *image.NRGBA {
+	if o.scratch == nil {
+		return utils.Img2NRGBA(img)
+	}
+	res := utils.Img2NRGBAInto(o.scratch[code], img)
+	o.scratch[code] = res
+	return res
+}
+
+// tuned reports whether encoder settings were provided.
+func (o *encodeOptions) tuned() bool {
+	return o.pngLevel != png.DefaultCompression || o.pngEncoder != nil || o.jpegQuality > 0
+}
+
+// WithPreserveUnknownChunks writes back, unmodified, the elements of a decoded file
+// that this package does not support, instead of dropping them.
+func WithPreserveUnknownChunks() EncodeOption {
+	return func(o *encodeOptions) {
+		o.preserveUnknown = true
+	}
+}
+
 // Encode writes a .icns file to the provided writer.
-func Encode(w io.Writer, i *ICNS) error {
-	buffers := make([]*bytes.Buffer, 0)
-	sizes := make([]uint32, 0)
-	types := make([]uint32, 0)
-	var totalSize uint32 = 8
+//
+// The elements of the file are written in a canonical order, so that the same icon
+// always produces the same output: the table of contents first, if requested,
+// then the images by increasing resolution and compatibility, each legacy image
+// being followed by its mask, then the dark icon, if any, and finally the raw elements
+// in the order they were added.
+//
+// Decoded images that were not replaced are written from their original data, unless
+// an Encoding or encoder settings are provided.
+//
+// When w is an io.WriteSeeker, elements are written as soon as they are encoded and
+// the size in the header is filled in afterwards, unless WithTOC or WithMaxFileSize
+// require the whole file to be known beforehand.
+func Encode(w io.Writer, i *ICNS, opts ...EncodeOption) error {
+	var o encodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if ws, ok := w.(io.WriteSeeker); ok && !o.toc && o.maxSize == 0 {
+		return encodeStream(ws, i, &o)
+	}
+
+	chunks, err := encodeFile(i, &o)
+	if err != nil {
+		return err
+	}
+	size := chunksSize(chunks)
+	if size > math.MaxUint32 {
+		return fmt.Errorf("icon too large: %d bytes", size)
+	}
+
+	hdr := make([]byte, 8)
+	wh := binary.Writer(hdr)
+	wh.Uint32(magic)
+	wh.Uint32(uint32(size))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if err := writeChunk(w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeStream writes the elements of the icon as soon as they are encoded,
+// then seeks back to write the size of the file in its header.
+func encodeStream(w io.WriteSeeker, i *ICNS, o *encodeOptions) error {
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	hdr := make([]byte, 8)
+	wh := binary.Writer(hdr)
+	wh.Uint32(magic)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
 
+	var size int64 = 8
+	err = eachChunk(i, o, func(c Chunk) error {
+		size += int64(len(c.Data)) + 8
+		return writeChunk(w, c)
+	})
+	if err != nil {
+		return err
+	}
+	if size > math.MaxUint32 {
+		return fmt.Errorf("icon too large: %d bytes", size)
+	}
+
+	if _, err := w.Seek(start+4, io.SeekStart); err != nil {
+		return err
+	}
+	wh = binary.Writer(hdr)
+	wh.Uint32(uint32(size))
+	if _, err := w.Write(hdr[:4]); err != nil {
+		return err
+	}
+	_, err = w.Seek(start+size, io.SeekStart)
+	return err
+}
+
+// writeChunk writes the header and data of an element.
+func writeChunk(w io.Writer, c Chunk) error {
+	hdr := make([]byte, 8)
+	wh := binary.Writer(hdr)
+	wh.Uint32(c.Code)
+	wh.Uint32(uint32(len(c.Data)) + 8)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(c.Data)
+	return err
+}
+
+// marshal builds a file made of the provided elements.
+func marshal(chunks []Chunk) []byte {
+	totalSize := uint32(chunksSize(chunks))
+
+	data := make([]byte, totalSize)
+	wd := binary.Writer(data)
+	wd.Uint32(magic)
+	wd.Uint32(totalSize)
+
+	for _, c := range chunks {
+		wd.Uint32(c.Code)
+		wd.Uint32(uint32(len(c.Data)) + 8)
+		wd.Section(c.Data)
+	}
+	return data
+}
+
+// EncodedSize returns the size of the file written by Encode with the provided options,
+// without building it. The images still need to be encoded.
+func (i *ICNS) EncodedSize(opts ...EncodeOption) (int64, error) {
+	var o encodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	chunks, err := encodeFile(i, &o)
+	if err != nil {
+		return 0, err
+	}
+	return chunksSize(chunks), nil
+}
+
+// chunksSize returns the size of a file made of the provided elements.
+func chunksSize(chunks []Chunk) int64 {
+	var size int64 = 8
+	for _, c := range chunks {
+		size += int64(len(c.Data)) + 8
+	}
+	return size
+}
+
+// encodeFile returns the elements of the file written by Encode.
+func encodeFile(i *ICNS, o *encodeOptions) ([]Chunk, error) {
+	chunks, err := encodeChunks(i, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.maxSize > 0 {
+		if chunks, err = o.fit(i, chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.toc {
+		toc := make([]byte, 8*len(chunks))
+		wt := binary.Writer(toc)
+		for _, c := range chunks {
+			wt.Uint32(c.Code)
+			wt.Uint32(uint32(len(c.Data)) + 8)
+		}
+		chunks = append([]Chunk{{Code: CodeTOC, Data: toc}}, chunks...)
+	}
+	return chunks, nil
+}
+
+// fit drops redundant images from the encoded elements until the file fits in the maximum size:
+// first the legacy images available in a modern format at the same resolution, oldest first,
+// then the images sharing their pixel size with a higher density image, such as icp5 (32pt@1x)
+// next to ic11 (16pt@2x), largest first.
+func (o *encodeOptions) fit(i *ICNS, chunks []Chunk) ([]Chunk, error) {
+	size := func() int64 {
+		s := chunksSize(chunks)
+		if o.toc {
+			s += 8 + 8*int64(len(chunks))
+		}
+		return s
+	}
+
+	var legacy, twins []*Format
 	for _, a := range i.Assets {
-		encoder := a.Format.Codec.Encode
-		if encoder == nil {
+		f := a.Format
+		if o.excluded(f) {
 			continue
 		}
+		for _, b := range i.Assets {
+			g := b.Format
+			if g == f || g.Res != f.Res || o.excluded(g) || g.legacy() {
+				continue
+			}
+			if f.legacy() {
+				legacy = append(legacy, f)
+				break
+			}
+			if g.Scale > f.Scale {
+				twins = append(twins, f)
+				break
+			}
+		}
+	}
+	sort.SliceStable(legacy, func(x, y int) bool {
+		if legacy[x].Compat != legacy[y].Compat {
+			return legacy[x].Compat < legacy[y].Compat
+		}
+		return legacy[x].Res > legacy[y].Res
+	})
+	sort.SliceStable(twins, func(x, y int) bool {
+		return twins[x].Res > twins[y].Res
+	})
 
-		// encode mask first
-		if a.Format.CombineCode != 0 {
-			// the encoders expect an NRGBA instance
-			a.Image = utils.Img2NRGBA(a.Image)
+	for _, f := range append(legacy, twins...) {
+		if size() <= o.maxSize {
+			break
+		}
+
+		res := chunks[:0:0]
+		for _, c := range chunks {
+			if c.Code != f.Code && c.Code != f.CombineCode {
+				res = append(res, c)
+			}
+		}
+		chunks = res
+		if o.dropped != nil {
+			*o.dropped = append(*o.dropped, f.Code)
+		}
+	}
+
+	if s := size(); s > o.maxSize {
+		return nil, &LimitError{Limit: "MaxFileSize", Value: s, Max: o.maxSize}
+	}
+	return chunks, nil
+}
+
+// encodeChunks encodes the elements of the icon, in canonical order.
+func encodeChunks(i *ICNS, o *encodeOptions) ([]Chunk, error) {
+	var chunks []Chunk
+	err := eachChunk(i, o, func(c Chunk) error {
+		chunks = append(chunks, c)
+		return nil
+	})
+	return chunks, err
+}
 
-			// encode alpha channel as separated mask
+// eachChunk encodes the elements of the icon, in canonical order, and passes them to emit.
+func eachChunk(i *ICNS, o *encodeOptions, emit func(Chunk) error) error {
+	var assets []*Img
+	for _, a := range i.Assets {
+		if !o.excluded(a.Format) {
+			assets = append(assets, a)
+		}
+	}
+	sort.SliceStable(assets, func(x, y int) bool {
+		fx, fy := assets[x].Format, assets[y].Format
+		if fx.Res != fy.Res {
+			return fx.Res < fy.Res
+		}
+		if fx.Compat != fy.Compat {
+			return fx.Compat < fy.Compat
+		}
+		return fx.Code < fy.Code
+	})
+
+	// Prepare the assets in order, up to the first error, so that the images
+	// to encode are known before encoding them, possibly concurrently.
+	type prepared struct {
+		img   image.Image
+		codec codec.Codec // nil when the data read from the source file is reused
+		dup   int         // index of an earlier asset with the same image and codec, or -1
+		data  []byte
+		err   error
+	}
+	jobs := make([]prepared, len(assets))
+	n := len(assets)
+	for k, a := range assets {
+		p := &jobs[k]
+		p.dup = -1
+		reencode := !a.unmodified() || (a.Encoding != EncodingAuto && a.Encoding != a.stored) || o.tuned()
+		if reencode || (a.Format.CombineCode != 0 && a.decodedMask() == nil) {
+			img, err := a.AsImage()
+			if err != nil {
+				p.err, n = err, k+1
+				break
+			}
+			if a.Format.CombineCode != 0 {
+				// the encoders expect an NRGBA instance
+				img = o.nrgba(a.Format.Code, img)
+			}
+			p.img = img
+		}
+		if !reencode {
+			p.data = a.Data
+			continue
+		}
+
+		c, err := a.Format.codecFor(a.Encoding)
+		if err != nil {
+			p.err, n = err, k+1
+			break
+		}
+		p.codec = c
+		if o.dedup && (c == codec.ImageCodec || c == codec.JPEGCodec || c == codec.ARGBCodec) {
+			for d := 0; d < k; d++ {
+				if jobs[d].codec == c && jobs[d].dup < 0 && utils.EqualImages(jobs[d].img, p.img) {
+					p.dup = d
+					break
+				}
+			}
+		}
+	}
+
+	encode := func(k int) {
+		p := &jobs[k]
+		if p.err != nil || p.codec == nil || p.dup >= 0 {
+			return
+		}
+		buf := new(bytes.Buffer)
+		if err := o.tune(p.codec).Encode(buf, p.img); err != nil {
+			p.err = err
+			return
+		}
+		p.data = buf.Bytes()
+	}
+	if o.parallelism > 1 {
+		parallel(o.parallelism, n, encode)
+	}
+
+	for k, a := range assets[:n] {
+		if o.parallelism <= 1 {
+			encode(k)
+		}
+		p := &jobs[k]
+		if p.err != nil {
+			return p.err
+		}
+		data := p.data
+		if p.dup >= 0 {
+			data = jobs[p.dup].data
+		}
+		img := p.img
+		if err := emit(Chunk{Code: a.Format.Code, Data: data}); err != nil {
+			return err
+		}
+
+		if a.Format.CombineCode != 0 {
+			// encode alpha channel as separated mask, unless the decoded one still applies
+			mask := img
+			if m := a.decodedMask(); m != nil {
+				mask = m
+			}
 			mformat := supportedMaskFormats[a.Format.CombineCode]
 			buf := new(bytes.Buffer)
-			if err := mformat.Codec.Encode(buf, a.Image); err != nil {
+			if err := mformat.Codec.Encode(buf, mask); err != nil {
+				return err
+			}
+			if err := emit(Chunk{Code: mformat.Code, Data: buf.Bytes()}); err != nil {
 				return err
 			}
-			size := uint32(buf.Len()) + 8
-			buffers = append(buffers, buf)
-			types = append(types, mformat.Code)
-			sizes = append(sizes, size)
-			totalSize += size
 		}
+	}
 
-		buf := new(bytes.Buffer)
-		if err := encoder(buf, a.Image); err != nil {
+	if i.dark != nil {
+		nested := *o
+		nested.maxSize = 0
+		dark, err := encodeFile(i.dark, &nested)
+		if err != nil {
+			return fmt.Errorf("dark icon: %w", err)
+		}
+		if err := emit(Chunk{Code: CodeDark, Data: marshal(dark)}); err != nil {
 			return err
 		}
-		size := uint32(buf.Len()) + 8
-		buffers = append(buffers, buf)
-		types = append(types, a.Format.Code)
-		sizes = append(sizes, size)
-		totalSize += size
 	}
 
-	data := make([]byte, totalSize)
-	wd := binary.Writer(data)
-	wd.Uint32(magic)
-	wd.Uint32(totalSize)
-
-	for idx := range buffers {
-		wd.Uint32(types[idx])
-		wd.Uint32(sizes[idx])
-		wd.Section(buffers[idx].Bytes())
+	if o.preserveUnknown {
+		for _, c := range i.unsupported {
+			if err := emit(c); err != nil {
+				return err
+			}
+		}
 	}
-
-	_, err := w.Write(data)
-	return err
+	for _, c := range i.extra {
+		if o.excludedCode(c.Code) {
+			continue
+		}
+		if err := emit(c); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,721 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icns
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kroksys/icns/codec"
+	"github.com/kroksys/icns/internal/binary"
+	"github.com/kroksys/icns/internal/utils"
+)
+
+func TestEncodePreserveUnknownChunks(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.unsupported) == 0 {
+		t.Fatal("expected the test file to contain unsupported chunks")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dropped, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped.unsupported) != 0 {
+		t.Errorf("unsupported chunks written by default: %d", len(dropped.unsupported))
+	}
+
+	buf.Reset()
+	if err := Encode(buf, i, WithPreserveUnknownChunks()); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(i.unsupported, kept.unsupported); diff != "" {
+		t.Errorf("unsupported chunks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRawChunks(t *testing.T) {
+	t.Parallel()
+	const code uint32 = 'x'<<24 | 'r'<<16 | 'a'<<8 | 'w'
+	payload := []byte("raw payload")
+
+	i := NewICNS()
+	i.AddRawChunk(code, payload)
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Chunk{{Code: code, Data: payload}}
+	if diff := cmp.Diff(want, dec.RawChunks()); diff != "" {
+		t.Errorf("RawChunks() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodeEncoding(t *testing.T) {
+	t.Parallel()
+	i := NewICNS(WithMinCompatibility(Cheetah))
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint32]Encoding{
+		CodeIc05: EncodingPNG,
+		CodeIcp5: EncodingJPEG,
+		CodeIc11: EncodingAuto,
+	}
+	for code, e := range want {
+		a, err := i.ByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Encoding = e
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoders := map[uint32]string{
+		CodeIc05: "png",
+		CodeIcp5: "jpeg",
+		CodeIc11: "png",
+	}
+	for code, enc := range encoders {
+		a, err := dec.ByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Encoder != enc {
+			t.Errorf("[%s] got %s data, want %s", CodeString(code), a.Encoder, enc)
+		}
+	}
+
+	a, _ := i.ByCode(CodeIcp5)
+	a.Encoding = EncodingARGB
+	if err := Encode(buf, i); err == nil {
+		t.Error("expected an error for an ARGB icp5 image")
+	}
+}
+
+func TestEncodeTuning(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i = i.Filter(func(a *Img) bool {
+		return a.Format.Code == CodeIc09
+	})
+
+	size := func(opts ...EncodeOption) int {
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i, opts...); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Len()
+	}
+
+	if fast, best := size(WithPNGCompression(png.NoCompression)), size(WithPNGCompression(png.BestCompression)); fast <= best {
+		t.Errorf("uncompressed PNG not larger than the best compression: %d <= %d", fast, best)
+	}
+
+	i.Assets[0].Encoding = EncodingJPEG
+	if low, high := size(WithJPEGQuality(10)), size(WithJPEGQuality(95)); low >= high {
+		t.Errorf("low quality JPEG not smaller than high quality: %d >= %d", low, high)
+	}
+}
+
+// countingPool counts the buffers obtained from a PNG encoder buffer pool.
+type countingPool struct {
+	pngBufferPool
+	gets atomic.Int32
+}
+
+func (p *countingPool) Get() *png.EncoderBuffer {
+	p.gets.Add(1)
+	return p.pngBufferPool.Get()
+}
+
+func TestWithPNGEncoder(t *testing.T) {
+	t.Parallel()
+	i := NewICNS()
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 128, 128))); err != nil {
+		t.Fatal(err)
+	}
+
+	p := new(countingPool)
+	e := &png.Encoder{CompressionLevel: png.BestSpeed, BufferPool: p}
+	for n := 1; n <= 2; n++ {
+		if err := Encode(io.Discard, i, WithPNGEncoder(e)); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.gets.Load(); got != int32(n) {
+			t.Errorf("got %d buffers requested after %d encodes, want %d", got, n, n)
+		}
+	}
+}
+
+// countingFormat counts the images encoded and decoded by an image format.
+type countingFormat struct {
+	codec.ImageFormat
+	encoded, decoded atomic.Int32
+}
+
+func (f *countingFormat) Encode(w io.Writer, img image.Image) error {
+	f.encoded.Add(1)
+	return f.ImageFormat.Encode(w, img)
+}
+
+func (f *countingFormat) Decode(r io.Reader) (image.Image, error) {
+	f.decoded.Add(1)
+	return f.ImageFormat.Decode(r)
+}
+
+func TestWithImageEncoders(t *testing.T) {
+	t.Parallel()
+	i := NewICNS()
+	i.Assets = []*Img{{
+		Image:  image.NewNRGBA(image.Rect(0, 0, 128, 128)),
+		Format: supportedImageFormats[CodeIc07],
+	}, {
+		Image:    image.NewNRGBA(image.Rect(0, 0, 256, 256)),
+		Format:   supportedImageFormats[CodeIc08],
+		Encoding: EncodingJPEG,
+	}}
+
+	p := &countingFormat{ImageFormat: codec.PNG(nil)}
+	j := &countingFormat{ImageFormat: codec.JPEG(0)}
+	if err := Encode(io.Discard, i, WithImageEncoders(p, j)); err != nil {
+		t.Fatal(err)
+	}
+	if n, m := p.encoded.Load(), j.encoded.Load(); n != 1 || m != 1 {
+		t.Errorf("got %d PNG and %d JPEG images encoded, want 1 each", n, m)
+	}
+}
+
+func TestMarkModified(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := i.ByCode(CodeIc07)
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.NRGBA{R: 0xff, A: 0xff}
+	a.Image.(draw.Image).Set(0, 0, red)
+
+	roundTrip := func() color.Color {
+		t.Helper()
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := dec.ByCode(CodeIc07)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return color.NRGBAModel.Convert(b.Image.At(0, 0))
+	}
+	if roundTrip() == red {
+		t.Fatal("in place modification written without MarkModified")
+	}
+	a.MarkModified()
+	if got := roundTrip(); got != red {
+		t.Errorf("got %v after MarkModified, want %v", got, red)
+	}
+
+	a.Encoding = EncodingJPEG
+	if err := a.ReEncode(WithJPEGQuality(50)); err != nil {
+		t.Fatal(err)
+	}
+	if a.DataEncoding() != EncodingJPEG || !bytes.HasPrefix(a.Data, jpegHeader) {
+		t.Fatalf("got %s data after ReEncode, want JPEG", a.DataEncoding())
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), a.Data) {
+		t.Error("data of ReEncode not written as is")
+	}
+}
+
+func TestEncodeLegacy(t *testing.T) {
+	t.Parallel()
+	for _, res := range []Resolution{Pixel16, Pixel32, Pixel48, Pixel128} {
+		src := image.NewNRGBA(image.Rect(0, 0, int(res), int(res)))
+		for y := 0; y < int(res); y++ {
+			for x := 0; x < int(res); x++ {
+				src.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: uint8(x * y)})
+			}
+		}
+
+		i := NewICNS(WithMaxCompatibility(Allegro))
+		if err := i.Add(src); err != nil {
+			t.Fatal(err)
+		}
+		if len(i.Assets) != 1 || i.Assets[0].Format.CombineCode == 0 {
+			t.Fatalf("%dpx: unexpected assets:\n%s", res, i.Info())
+		}
+
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := Decode(buf, WithoutMaskCompositing(), WithStrictDecoding())
+		if err != nil {
+			t.Fatalf("%dpx: %v", res, err)
+		}
+
+		img, err := dec.ByResolution(res)
+		if err != nil {
+			t.Fatalf("%dpx: %v", res, err)
+		}
+		mask, err := dec.MaskByResolution(res)
+		if err != nil {
+			t.Fatalf("%dpx: %v", res, err)
+		}
+		for y := 0; y < int(res); y++ {
+			for x := 0; x < int(res); x++ {
+				want := src.NRGBAAt(x, y)
+				got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				got.A = mask.(*image.Alpha).AlphaAt(x, y).A
+				if got != want {
+					t.Fatalf("%dpx: pixel (%d, %d): got %v, want %v", res, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeLegacyReplaced(t *testing.T) {
+	t.Parallel()
+	i := NewICNS(WithMaxCompatibility(Allegro))
+	if err := i.Add(image.NewNRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the decoded mask is transparent, but no longer applies to the new image
+	opaque := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.NRGBA{G: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	a, err := dec.ByCode(CodeIl32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Image = opaque
+
+	buf.Reset()
+	if err := Encode(buf, dec); err != nil {
+		t.Fatal(err)
+	}
+	dec, err = Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := dec.ByResolution(Pixel32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(12, 3).RGBA(); a != 0xffff {
+		t.Errorf("got alpha %#x after replacing the image, want opaque", a)
+	}
+}
+
+func TestEncodeTOC(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithTOC()); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Assets) != len(i.Assets) || len(dec.unsupported) != 0 {
+		t.Fatalf("unexpected icon after encoding with a TOC:\n%s", dec.Info())
+	}
+
+	chunks := dec.RawChunks()
+	if chunks[0].Code != CodeTOC {
+		t.Fatalf("first element is %s, want a TOC", CodeString(chunks[0].Code))
+	}
+	toc := binary.Reader(chunks[0].Data)
+	for _, c := range chunks[1:] {
+		code, _ := toc.Uint32()
+		size, _ := toc.Uint32()
+		if code != c.Code || int(size) != len(c.Data)+8 {
+			t.Errorf("TOC entry %s (%d bytes), want %s (%d bytes)", CodeString(code), size, CodeString(c.Code), len(c.Data)+8)
+		}
+	}
+	if len(toc) != 0 {
+		t.Errorf("%d unexpected bytes at the end of the TOC", len(toc))
+	}
+}
+
+func TestEncodeCanonicalOrder(t *testing.T) {
+	t.Parallel()
+	var outputs [][]byte
+	for n := 0; n < 5; n++ {
+		i := NewICNS()
+		for _, res := range []int{512, 16, 128, 32} {
+			if err := i.Add(image.NewNRGBA(image.Rect(0, 0, res, res))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i, WithTOC()); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, buf.Bytes())
+	}
+	for _, o := range outputs[1:] {
+		if !bytes.Equal(o, outputs[0]) {
+			t.Fatal("the same icon produced different outputs")
+		}
+	}
+
+	dec, err := Decode(bytes.NewReader(outputs[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range dec.RawChunks() {
+		got = append(got, CodeString(c.Code))
+	}
+	want := []string{
+		"TOC ",
+		"is32", "s8mk", "ic04", "icp4",
+		"il32", "l8mk", "ic05", "icp5", "ic11",
+		"it32", "t8mk", "ic07",
+		"ic09", "ic14",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("chunk order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodeReuseData(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := i.ByCode(CodeIc07)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced.Image = utils.CloneImage(replaced.Image)
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithPreserveUnknownChunks()); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range i.Assets {
+		b, err := dec.ByCode(a.Format.Code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := bytes.Equal(a.Data, b.Data); same == (a == replaced) {
+			t.Errorf("[%s] original data reused: %v", CodeString(a.Format.Code), same)
+		}
+	}
+
+	// decoding and encoding again is lossless
+	buf2 := new(bytes.Buffer)
+	if err := Encode(buf2, dec.Clone(), WithPreserveUnknownChunks()); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := Encode(buf, dec, WithPreserveUnknownChunks()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Error("re-encoding a decoded icon modified it")
+	}
+}
+
+func TestEncodeDeduplication(t *testing.T) {
+	t.Parallel()
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for idx := range src.Pix {
+		src.Pix[idx] = uint8(idx)
+	}
+
+	i := NewICNS()
+	if err := i.Add(src); err != nil {
+		t.Fatal(err)
+	}
+	a, err := i.ByCode(CodeIc11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Image = utils.CloneImage(src) // same pixels, other instance
+
+	chunks := func(opts ...EncodeOption) map[uint32][]byte {
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i, opts...); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make(map[uint32][]byte)
+		for _, c := range dec.RawChunks() {
+			res[c.Code] = c.Data
+		}
+		return res
+	}
+
+	dedup := chunks(WithDeduplication())
+	if !bytes.Equal(dedup[CodeIcp5], dedup[CodeIc11]) {
+		t.Error("identical icp5 and ic11 images encoded differently")
+	}
+	raw, err := encodeChunks(i, &encodeOptions{dedup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(map[uint32][]byte)
+	for _, c := range raw {
+		data[c.Code] = c.Data
+	}
+	if &data[CodeIcp5][0] != &data[CodeIc11][0] {
+		t.Error("identical icp5 and ic11 images encoded separately")
+	}
+	if bytes.Equal(dedup[CodeIcp5], dedup[CodeIc05]) {
+		t.Error("ARGB ic05 image shares the PNG data")
+	}
+
+	a.Image = image.NewNRGBA(src.Rect)
+	if c := chunks(WithDeduplication()); bytes.Equal(c[CodeIcp5], c[CodeIc11]) {
+		t.Error("different icp5 and ic11 images share their data")
+	}
+}
+
+func TestEncodeCompatibility(t *testing.T) {
+	t.Parallel()
+	i := NewICNS()
+	for _, res := range []int{16, 32, 128} {
+		if err := i.Add(image.NewNRGBA(image.Rect(0, 0, res, res))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i.AddRawChunk(CodeS8mk, make([]byte, 16*16))
+	i.AddRawChunk(CodeIc07, []byte("raw"))
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithCompatibility(Lion, Newest)); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(buf, WithStrictDecoding())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range dec.RawChunks() {
+		if f, ok := supportedImageFormats[c.Code]; !ok || f.Compat < Lion {
+			t.Errorf("[%s] unexpected element", CodeString(c.Code))
+		}
+	}
+	if min, max := dec.Compatibility(); min != Lion || max != MountainLion {
+		t.Errorf("got compatibility %v-%v, want %v-%v", min, max, Lion, MountainLion)
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]EncodeOption{
+		nil,
+		{WithTOC(), WithPreserveUnknownChunks()},
+		{WithPNGCompression(png.BestSpeed), WithCompatibility(Lion, Newest)},
+	} {
+		size, err := i.EncodedSize(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, i, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if size != int64(buf.Len()) {
+			t.Errorf("EncodedSize() = %d, want %d", size, buf.Len())
+		}
+	}
+}
+
+func TestEncodeMaxFileSize(t *testing.T) {
+	t.Parallel()
+	i := NewICNS()
+	for _, res := range []int{16, 32, 64} {
+		src := image.NewNRGBA(image.Rect(0, 0, res, res))
+		for idx := range src.Pix {
+			src.Pix[idx] = uint8(idx * idx)
+		}
+		if err := i.Add(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	full, err := i.EncodedSize(WithTOC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dropped []uint32
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, i, WithTOC(), WithMaxFileSize(full, &dropped)); err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 0 {
+		t.Errorf("images dropped from a file within the limit: %v", dropped)
+	}
+
+	if err := Encode(buf, i, WithTOC(), WithMaxFileSize(full-1, &dropped)); err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 || !supportedImageFormats[dropped[0]].legacy() {
+		t.Errorf("got %v dropped, want a single legacy image", dropped)
+	}
+
+	dropped = nil
+	buf.Reset()
+	if err := Encode(buf, i, WithMaxFileSize(1, &dropped)); err == nil {
+		t.Error("expected an error for a file that cannot fit")
+	} else if le, ok := err.(*LimitError); !ok || le.Limit != "MaxFileSize" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, code := range dropped {
+		got = append(got, CodeString(code))
+	}
+	want := []string{"il32", "is32", "ic05", "ic04", "icp6", "icp5"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("dropped images mismatch (-want +got):\n%s", diff)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes written for a file that cannot fit", buf.Len())
+	}
+}
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	off  int64
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.off + int64(len(p)); end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+	n := copy(b.data[b.off:], p)
+	b.off += int64(n)
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	b.off = offset
+	return offset, nil
+}
+
+func TestEncodeWriteSeeker(t *testing.T) {
+	t.Parallel()
+	i, err := Decode(testdataFileReader(t, "mit.icns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := new(bytes.Buffer)
+	if err := Encode(want, i); err != nil {
+		t.Fatal(err)
+	}
+
+	// start past existing data, to check the size is patched at the right offset
+	ws := &seekBuffer{data: []byte("prefix")}
+	ws.off = 6
+	if err := Encode(ws, i); err != nil {
+		t.Fatal(err)
+	}
+	if ws.off != int64(len(ws.data)) {
+		t.Errorf("writer left at offset %d, want %d", ws.off, len(ws.data))
+	}
+	if diff := cmp.Diff(want.Bytes(), ws.data[6:]); diff != "" {
+		t.Errorf("streamed output differs from buffered output (-want +got):\n%s", diff)
+	}
+}